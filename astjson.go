@@ -0,0 +1,296 @@
+package gorules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// astVersion JSON AST格式的版本号，格式不兼容地变化时加一
+const astVersion = 1
+
+// RuleAST 规则的JSON AST，Lets是按顺序定义的let变量，Expr是结果表达式
+type RuleAST struct {
+	Version int       `json:"version"`
+	Lets    []LetNode `json:"lets,omitempty"`
+	Expr    *Node     `json:"expr"`
+}
+
+// LetNode let name = expr
+type LetNode struct {
+	Name string `json:"name"`
+	Expr *Node  `json:"expr"`
+}
+
+// Node 表达式节点，Kind决定使用哪些字段：
+//
+//	binary                     Op是运算符（+ - * / == != < <= > >= && ||），Args是左右两个操作数
+//	field                      Name是字段名或let变量名
+//	var                        Name是外部参数名，不带$
+//	string、int、float、bool    Value是字面量的值
+//	select                     Args[0].Name，选择字段
+//	index                      Args[0][Args[1]]
+//	call                       Name是函数名（in），Args是参数
+type Node struct {
+	Kind  string          `json:"kind"`
+	Op    string          `json:"op,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Args  []*Node         `json:"args,omitempty"`
+}
+
+// binaryTokens JSON AST中运算符对应的token
+var binaryTokens = map[string]token.Token{}
+
+func init() {
+	for tok := range mathFuncs {
+		binaryTokens[tok.String()] = tok
+	}
+	for tok := range compareFuncs {
+		binaryTokens[tok.String()] = tok
+	}
+	binaryTokens[token.LAND.String()] = token.LAND
+	binaryTokens[token.LOR.String()] = token.LOR
+}
+
+// MarshalRule 把NewRule、NewRuleFor创建的规则编码为JSON AST，绑定的输入类型不编码，
+// 运算符中的&、<、>不转义
+func MarshalRule(r Rule) ([]byte, error) {
+	ru, ok := r.(*rule)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupport rule type %T", ErrInvalidAST, r)
+	}
+	a, err := ru.toAST()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(a); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// MarshalJSON 规则的JSON AST
+func (r *rule) MarshalJSON() ([]byte, error) {
+	a, err := r.toAST()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(a)
+}
+
+// toAST 规则的JSON AST
+func (r *rule) toAST() (*RuleAST, error) {
+	a := &RuleAST{Version: astVersion}
+	sc := scope{}
+	for i, l := range r.lets {
+		n, err := toNode(l.expr, sc)
+		if err != nil {
+			return nil, err
+		}
+		a.Lets = append(a.Lets, LetNode{Name: l.name, Expr: n})
+		sc[l.name] = i
+	}
+	n, err := toNode(r.expr, sc)
+	if err != nil {
+		return nil, err
+	}
+	a.Expr = n
+	return a, nil
+}
+
+func toNode(expr ast.Expr, sc scope) (*Node, error) {
+	switch t := expr.(type) {
+	case *ast.ParenExpr:
+		return toNode(t.X, sc)
+	case *ast.BinaryExpr:
+		return toNodes(&Node{Kind: "binary", Op: t.Op.String()}, sc, t.X, t.Y)
+	case *ast.Ident:
+		if _, ok := sc[t.Name]; !ok && (t.Name == "true" || t.Name == "false") {
+			return &Node{Kind: "bool", Value: json.RawMessage(t.Name)}, nil
+		}
+		if strings.HasPrefix(t.Name, paramPrefix) {
+			return &Node{Kind: "var", Name: t.Name[len(paramPrefix):]}, nil
+		}
+		return &Node{Kind: "field", Name: t.Name}, nil
+	case *ast.BasicLit:
+		v, err := parseLit(t)
+		if err != nil {
+			return nil, err
+		}
+		n := &Node{Kind: strings.ToLower(t.Kind.String())}
+		n.Value, err = json.Marshal(v)
+		return n, err
+	case *ast.SelectorExpr:
+		return toNodes(&Node{Kind: "select", Name: t.Sel.Name}, sc, t.X)
+	case *ast.IndexExpr:
+		return toNodes(&Node{Kind: "index"}, sc, t.X, t.Index)
+	case *ast.CallExpr:
+		f, ok := t.Fun.(*ast.Ident)
+		if !ok {
+			return nil, ErrUnsupportExpr
+		}
+		return toNodes(&Node{Kind: "call", Name: strings.ToLower(f.Name)}, sc, t.Args...)
+	default:
+		return nil, ErrUnsupportExpr
+	}
+}
+
+func toNodes(n *Node, sc scope, args ...ast.Expr) (*Node, error) {
+	for _, a := range args {
+		c, err := toNode(a, sc)
+		if err != nil {
+			return nil, err
+		}
+		n.Args = append(n.Args, c)
+	}
+	return n, nil
+}
+
+// UnmarshalRule 从JSON AST编译规则，与NewRule编译同样的源码得到相同的规则
+func UnmarshalRule(data []byte) (Rule, error) {
+	ru, err := unmarshalRule(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
+
+// UnmarshalRuleFor 从JSON AST编译规则并绑定输入类型，typ与NewRuleFor相同
+func UnmarshalRuleFor(typ interface{}, data []byte) (TypedRule, error) {
+	t, err := inputType(typ)
+	if err != nil {
+		return nil, err
+	}
+	ru, err := unmarshalRule(data, t)
+	if err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
+
+func unmarshalRule(data []byte, input reflect.Type) (*rule, error) {
+	var a RuleAST
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAST, err)
+	}
+	return a.compile(input)
+}
+
+// Compile 编译JSON AST，前端构造的AST不必经过文本
+func (a *RuleAST) Compile() (Rule, error) {
+	ru, err := a.compile(nil)
+	if err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
+
+func (a *RuleAST) compile(input reflect.Type) (*rule, error) {
+	if a.Version != astVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidAST, a.Version)
+	}
+	ru := &rule{input: input}
+	cp := newCompiler(input)
+	for _, l := range a.Lets {
+		if !token.IsIdentifier(l.Name) {
+			return nil, fmt.Errorf("%w: invalid let name %q", ErrInvalidAST, l.Name)
+		}
+		expr, err := l.Expr.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := ru.let(cp, l.Name, expr); err != nil {
+			return nil, err
+		}
+	}
+	expr, err := a.Expr.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := ru.body(cp, expr); err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
+
+// expr 把节点还原为go/ast的表达式
+func (n *Node) expr() (ast.Expr, error) {
+	if n == nil {
+		return nil, fmt.Errorf("%w: missing expression", ErrInvalidAST)
+	}
+	args := make([]ast.Expr, len(n.Args))
+	for i, a := range n.Args {
+		e, err := a.expr()
+		if err != nil {
+			return nil, err
+		}
+		args[i] = e
+	}
+	arity := map[string]int{"binary": 2, "select": 1, "index": 2, "call": 2}[n.Kind]
+	if len(args) != arity {
+		return nil, fmt.Errorf("%w: %s needs %d args, got %d", ErrInvalidAST, n.Kind, arity, len(args))
+	}
+	switch n.Kind {
+	case "binary":
+		op, ok := binaryTokens[n.Op]
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported operator %q", ErrInvalidAST, n.Op)
+		}
+		return &ast.BinaryExpr{X: args[0], Op: op, Y: args[1]}, nil
+	case "field", "var", "select", "call":
+		// 与Expr构造器一样，名字为true、false的字段会被当成bool常量
+		if err := checkName(n.Name); err != nil {
+			return nil, fmt.Errorf("%s: %w", n.Kind, err)
+		}
+	}
+	switch n.Kind {
+	case "field":
+		return ast.NewIdent(n.Name), nil
+	case "var":
+		return ast.NewIdent(paramPrefix + n.Name), nil
+	case "select":
+		return &ast.SelectorExpr{X: args[0], Sel: ast.NewIdent(n.Name)}, nil
+	case "index":
+		return &ast.IndexExpr{X: args[0], Index: args[1]}, nil
+	case "call":
+		if n.Name != "in" {
+			return nil, fmt.Errorf("%w: unsupported function %q", ErrInvalidAST, n.Name)
+		}
+		return &ast.CallExpr{Fun: ast.NewIdent(n.Name), Args: args}, nil
+	case "bool":
+		var b bool
+		if err := json.Unmarshal(n.Value, &b); err != nil {
+			return nil, fmt.Errorf("%w: bool value: %v", ErrInvalidAST, err)
+		}
+		return ast.NewIdent(strconv.FormatBool(b)), nil
+	case "string":
+		var s string
+		if err := json.Unmarshal(n.Value, &s); err != nil {
+			return nil, fmt.Errorf("%w: string value: %v", ErrInvalidAST, err)
+		}
+		return &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(s)}, nil
+	case "int":
+		var i int64
+		if err := json.Unmarshal(n.Value, &i); err != nil {
+			return nil, fmt.Errorf("%w: int value: %v", ErrInvalidAST, err)
+		}
+		return &ast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(i, 10)}, nil
+	case "float":
+		var f float64
+		if err := json.Unmarshal(n.Value, &f); err != nil {
+			return nil, fmt.Errorf("%w: float value: %v", ErrInvalidAST, err)
+		}
+		return &ast.BasicLit{Kind: token.FLOAT, Value: strconv.FormatFloat(f, 'g', -1, 64)}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown node kind %q", ErrInvalidAST, n.Kind)
+	}
+}
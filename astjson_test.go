@@ -0,0 +1,102 @@
+package gorules
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalRule_roundTrip(t *testing.T) {
+	base := Env{
+		Input: evalType{A: 3, B: 1.5, C: "abc", D: []string{"x", "y"}, E: []int64{7}, F: xyz{Z: []string{"z"}}},
+		Vars:  Vars{"min": 2},
+	}
+	rules := []string{
+		"a*b",
+		"(a + b) * 2 > $min && c == \"abc\"",
+		"a > 1 || false",
+		"e[0] - 0.25",
+		"in(f.z, \"z\") && IN(d, c)",
+		"let m = a / 2; let n = m + b; n >= 3",
+		"let a = 1.0; a == 1",
+	}
+	for _, src := range rules {
+		r, err := NewRule(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := MarshalRule(r)
+		if err != nil {
+			t.Fatalf("MarshalRule(%s) error = %v", src, err)
+		}
+		got, err := UnmarshalRule(data)
+		if err != nil {
+			t.Fatalf("UnmarshalRule(%s) error = %v", data, err)
+		}
+		want, wantErr := r.Eval(base)
+		v, err := got.Eval(base)
+		if !reflect.DeepEqual(v, want) || (err == nil) != (wantErr == nil) {
+			t.Errorf("%s: Eval() = %v, %v, want %v, %v", src, v, err, want, wantErr)
+		}
+		again, _ := MarshalRule(got)
+		if string(again) != string(data) {
+			t.Errorf("%s: marshal again = %s, want %s", src, again, data)
+		}
+	}
+}
+
+func TestMarshalRule_format(t *testing.T) {
+	r, _ := NewRule(`let m = a; (m + 1.5) > $x && in(d, "y")`)
+	data, err := MarshalRule(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if escaped, _ := json.Marshal(r); !json.Valid(escaped) {
+		t.Errorf("json.Marshal() = %s", escaped)
+	}
+	want := `{"version":1,"lets":[{"name":"m","expr":{"kind":"field","name":"a"}}],"expr":{"kind":"binary","op":"&&","args":[` +
+		`{"kind":"binary","op":">","args":[{"kind":"binary","op":"+","args":[{"kind":"field","name":"m"},{"kind":"float","value":1.5}]},{"kind":"var","name":"x"}]},` +
+		`{"kind":"call","name":"in","args":[{"kind":"field","name":"d"},{"kind":"string","value":"y"}]}]}}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s\nwant %s", data, want)
+	}
+	typed, err := UnmarshalRuleFor(evalType{}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := typed.Bool(Env{Input: evalType{A: 3, D: []string{"y"}}, Vars: Vars{"x": 4}}); !ok || err != nil {
+		t.Errorf("Bool() = %v, %v", ok, err)
+	}
+}
+
+func TestUnmarshalRule_errors(t *testing.T) {
+	tests := []string{
+		`{"version":2,"expr":{"kind":"bool","value":true}}`,
+		`{"version":1}`,
+		`{"version":1,"expr":{"kind":"binary","op":"%","args":[{"kind":"int","value":1},{"kind":"int","value":2}]}}`,
+		`{"version":1,"expr":{"kind":"binary","op":"+","args":[{"kind":"int","value":1}]}}`,
+		`{"version":1,"expr":{"kind":"field","name":"a b"}}`,
+		`{"version":1,"expr":{"kind":"field","name":"__param_x"}}`,
+		`{"version":1,"expr":{"kind":"field","name":"true"}}`,
+		`{"version":1,"expr":{"kind":"var","name":"false"}}`,
+		`{"version":1,"expr":{"kind":"select","name":"true","args":[{"kind":"field","name":"a"}]}}`,
+		`{"version":1,"expr":{"kind":"call","name":"len","args":[{"kind":"field","name":"a"},{"kind":"field","name":"b"}]}}`,
+		`{"version":1,"expr":{"kind":"int","value":1.5}}`,
+		`{"version":1,"expr":{"kind":"lambda"}}`,
+		`{"version":1,"lets":[{"name":"1x","expr":{"kind":"int","value":1}}],"expr":{"kind":"bool","value":true}}`,
+		`[`,
+	}
+	for _, data := range tests {
+		if _, err := UnmarshalRule([]byte(data)); !errors.Is(err, ErrInvalidAST) {
+			t.Errorf("UnmarshalRule(%s) error = %v, want ErrInvalidAST", data, err)
+		}
+	}
+	if _, err := UnmarshalRule([]byte(`{"version":1,"lets":[{"name":"a","expr":{"kind":"int","value":1}},{"name":"a","expr":{"kind":"int","value":2}}],"expr":{"kind":"field","name":"a"}}`)); !errors.Is(err, ErrInvalidLet) {
+		t.Errorf("duplicate let error = %v, want ErrInvalidLet", err)
+	}
+	p, _ := NewProgram("a > 1")
+	if _, err := MarshalRule(p); !errors.Is(err, ErrInvalidAST) {
+		t.Errorf("MarshalRule(Program) error = %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package gorules
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Expr 用Go代码构造的规则表达式，代替拼接字符串：
+//
+//	Field("a").Gt(Field("b").Sub(Lit(3))).And(In(Field("d"), Field("b")))
+//
+// 字段名、参数名在构造时检查，字符串字面量总是正确转义；构造过程中的错误在Rule时返回
+type Expr struct {
+	expr ast.Expr
+	err  error
+}
+
+// Field 字段，path可以是a.b.c形式的路径
+func Field(path string) Expr {
+	var expr ast.Expr
+	for _, name := range strings.Split(path, ".") {
+		if err := checkName(name); err != nil {
+			return Expr{err: err}
+		}
+		if expr == nil {
+			expr = ast.NewIdent(name)
+		} else {
+			expr = &ast.SelectorExpr{X: expr, Sel: ast.NewIdent(name)}
+		}
+	}
+	return Expr{expr: expr}
+}
+
+// Var 外部参数，即规则中的$name
+func Var(name string) Expr {
+	if err := checkName(name); err != nil {
+		return Expr{err: err}
+	}
+	return Expr{expr: ast.NewIdent(paramPrefix + name)}
+}
+
+// checkName 字段名、参数名必须是标识符，不能是true、false
+func checkName(name string) error {
+	if !token.IsIdentifier(name) || name == "true" || name == "false" || strings.HasPrefix(name, paramPrefix) {
+		return fmt.Errorf("%w: invalid name %q", ErrInvalidAST, name)
+	}
+	return nil
+}
+
+// Lit 字面量，v可以是bool、字符串、整数和浮点数。规则不支持一元负号，负数写成0减去它的绝对值
+func Lit(v interface{}) Expr {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return Expr{expr: ast.NewIdent(strconv.FormatBool(rv.Bool()))}
+	case reflect.String:
+		return Expr{expr: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(rv.String())}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if i < 0 {
+			return negative(&ast.BasicLit{Kind: token.INT, Value: strconv.FormatUint(uint64(-(i+1))+1, 10)})
+		}
+		return Expr{expr: &ast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(i, 10)}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Expr{expr: &ast.BasicLit{Kind: token.INT, Value: strconv.FormatUint(rv.Uint(), 10)}}
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return Expr{err: fmt.Errorf("%w: invalid number %v", ErrInvalidAST, f)}
+		}
+		s := strconv.FormatFloat(math.Abs(f), 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		lit := &ast.BasicLit{Kind: token.FLOAT, Value: s}
+		if f < 0 {
+			return negative(lit)
+		}
+		return Expr{expr: lit}
+	default:
+		return Expr{err: fmt.Errorf("%w: unsupport literal %T", ErrInvalidAST, v)}
+	}
+}
+
+func negative(lit *ast.BasicLit) Expr {
+	zero := &ast.BasicLit{Kind: lit.Kind, Value: "0"}
+	if lit.Kind == token.FLOAT {
+		zero.Value = "0.0"
+	}
+	return Expr{expr: &ast.BinaryExpr{X: zero, Op: token.SUB, Y: lit}}
+}
+
+// In slice中是否包含key，即in(slice, key)
+func In(slice, key Expr) Expr {
+	if err := firstErr(slice, key); err != nil {
+		return Expr{err: err}
+	}
+	return Expr{expr: &ast.CallExpr{Fun: ast.NewIdent("in"), Args: []ast.Expr{slice.expr, key.expr}}}
+}
+
+func firstErr(exprs ...Expr) error {
+	for _, e := range exprs {
+		if e.err != nil {
+			return e.err
+		}
+		if e.expr == nil {
+			return fmt.Errorf("%w: empty expression", ErrInvalidAST)
+		}
+	}
+	return nil
+}
+
+func (e Expr) binary(op token.Token, y Expr) Expr {
+	if err := firstErr(e, y); err != nil {
+		return Expr{err: err}
+	}
+	return Expr{expr: &ast.BinaryExpr{X: e.expr, Op: op, Y: y.expr}}
+}
+
+// Add e + y
+func (e Expr) Add(y Expr) Expr { return e.binary(token.ADD, y) }
+
+// Sub e - y
+func (e Expr) Sub(y Expr) Expr { return e.binary(token.SUB, y) }
+
+// Mul e * y
+func (e Expr) Mul(y Expr) Expr { return e.binary(token.MUL, y) }
+
+// Div e / y
+func (e Expr) Div(y Expr) Expr { return e.binary(token.QUO, y) }
+
+// Eq e == y
+func (e Expr) Eq(y Expr) Expr { return e.binary(token.EQL, y) }
+
+// Ne e != y
+func (e Expr) Ne(y Expr) Expr { return e.binary(token.NEQ, y) }
+
+// Lt e < y
+func (e Expr) Lt(y Expr) Expr { return e.binary(token.LSS, y) }
+
+// Le e <= y
+func (e Expr) Le(y Expr) Expr { return e.binary(token.LEQ, y) }
+
+// Gt e > y
+func (e Expr) Gt(y Expr) Expr { return e.binary(token.GTR, y) }
+
+// Ge e >= y
+func (e Expr) Ge(y Expr) Expr { return e.binary(token.GEQ, y) }
+
+// And e && y
+func (e Expr) And(y Expr) Expr { return e.binary(token.LAND, y) }
+
+// Or e || y
+func (e Expr) Or(y Expr) Expr { return e.binary(token.LOR, y) }
+
+// Field 选择e的字段，如Field("items").Index(Lit(0)).Field("price")
+func (e Expr) Field(name string) Expr {
+	if err := firstErr(e); err != nil {
+		return Expr{err: err}
+	}
+	if err := checkName(name); err != nil {
+		return Expr{err: err}
+	}
+	return Expr{expr: &ast.SelectorExpr{X: e.expr, Sel: ast.NewIdent(name)}}
+}
+
+// Index 按下标取slice、array的元素
+func (e Expr) Index(i Expr) Expr {
+	if err := firstErr(e, i); err != nil {
+		return Expr{err: err}
+	}
+	return Expr{expr: &ast.IndexExpr{X: e.expr, Index: i.expr}}
+}
+
+// String 规范格式的规则文本，NewRule(e.String())与e.Rule()得到相同的规则
+func (e Expr) String() string {
+	if e.err != nil {
+		return fmt.Sprintf("!error(%v)", e.err)
+	}
+	if e.expr == nil {
+		return ""
+	}
+	return exprText(e.expr)
+}
+
+// Rule 编译表达式
+func (e Expr) Rule() (Rule, error) {
+	ru, err := e.compile(nil)
+	if err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
+
+// RuleFor 编译表达式并绑定输入类型，typ与NewRuleFor相同
+func (e Expr) RuleFor(typ interface{}) (TypedRule, error) {
+	t, err := inputType(typ)
+	if err != nil {
+		return nil, err
+	}
+	ru, err := e.compile(t)
+	if err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
+
+func (e Expr) compile(input reflect.Type) (*rule, error) {
+	if err := firstErr(e); err != nil {
+		return nil, err
+	}
+	ru := &rule{input: input}
+	if err := ru.body(newCompiler(input), e.expr); err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
@@ -0,0 +1,71 @@
+package gorules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExpr_String(t *testing.T) {
+	tests := []struct {
+		expr Expr
+		want string
+	}{
+		{expr: Field("a").Gt(Field("b").Sub(Lit(3))).And(In(Field("d"), Field("c"))), want: `a > b - 3 && in(d, c)`},
+		{expr: Field("a").Sub(Field("b").Sub(Lit(1))), want: `a - (b - 1)`},
+		{expr: Field("a").Sub(Field("b")).Sub(Lit(1)), want: `a - b - 1`},
+		{expr: Field("a").Mul(Field("b").Add(Lit(1.5))), want: `a * (b + 1.5)`},
+		{expr: Field("a").Mul(Lit(-2)), want: `a * (0 - 2)`},
+		{expr: Field("b").Eq(Lit(2.0)), want: `b == 2.0`},
+		{expr: Field("a").Lt(Lit(1)).Or(Lit(true)).And(Field("c").Ne(Lit(`x"y`))), want: `(a < 1 || true) && c != "x\"y"`},
+		{expr: Field("f.z").Index(Lit(0)).Eq(Var("name")), want: `f.z[0] == $name`},
+		{expr: Field("e").Index(Lit(uint8(0))).Div(Lit(-0.5)).Ge(Lit(-7)), want: `e[0] / (0.0 - 0.5) >= 0 - 7`},
+	}
+	base := Env{
+		Input: evalType{A: 3, B: 2, C: "x\"y", D: []string{"x\"y"}, E: []int64{7}, F: xyz{Z: []string{"n"}}},
+		Vars:  Vars{"name": "n"},
+	}
+	for _, tt := range tests {
+		if got := tt.expr.String(); got != tt.want {
+			t.Errorf("String() = %s, want %s", got, tt.want)
+		}
+		r, err := tt.expr.Rule()
+		if err != nil {
+			t.Fatalf("%s: Rule() error = %v", tt.want, err)
+		}
+		parsed, err := NewRule(tt.expr.String())
+		if err != nil {
+			t.Fatalf("NewRule(%s) error = %v", tt.want, err)
+		}
+		built, _ := MarshalRule(r)
+		want, _ := MarshalRule(parsed)
+		if string(built) != string(want) {
+			t.Errorf("%s: built %s, want %s", tt.want, built, want)
+		}
+		got, err := r.Eval(base)
+		wantV, wantErr := parsed.Eval(base)
+		if !reflect.DeepEqual(got, wantV) || (err == nil) != (wantErr == nil) {
+			t.Errorf("%s: Eval() = %v, %v, want %v, %v", tt.want, got, err, wantV, wantErr)
+		}
+	}
+}
+
+func TestExpr_errors(t *testing.T) {
+	tests := []Expr{
+		Field("a b"),
+		Field("a..b"),
+		Field("true"),
+		Var("$x"),
+		Field("a").Gt(Lit([]int{1})),
+		In(Field("d"), Expr{}),
+		Field("a").Field("1"),
+	}
+	for _, e := range tests {
+		if _, err := e.Rule(); !errors.Is(err, ErrInvalidAST) {
+			t.Errorf("%s: Rule() error = %v, want ErrInvalidAST", e, err)
+		}
+	}
+	if _, err := Field("c").Add(Lit(1)).RuleFor(evalType{}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("RuleFor() error = %v, want ErrTypeMismatch", err)
+	}
+}
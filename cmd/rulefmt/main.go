@@ -0,0 +1,102 @@
+// rulefmt 把规则文本输出为规范格式，每行一条规则，空行原样保留：
+//
+//	rulefmt rules.txt            输出格式化后的规则
+//	rulefmt -w rules.txt         直接改写文件
+//	rulefmt -l rules.txt         列出格式不规范的文件
+//	echo 'A>1&&IN(d,"x")' | rulefmt
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	gorules "go-rules"
+)
+
+func main() {
+	var (
+		write = flag.Bool("w", false, "write result to source file instead of stdout")
+		list  = flag.Bool("l", false, "list files whose formatting differs")
+	)
+	flag.Parse()
+	if flag.NArg() == 0 {
+		data, err := readAll(os.Stdin)
+		if err == nil {
+			data, err = format("<stdin>", data)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "rulefmt:", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+	failed := false
+	for _, name := range flag.Args() {
+		if err := formatFile(name, *write, *list); err != nil {
+			fmt.Fprintln(os.Stderr, "rulefmt:", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func formatFile(name string, write, list bool) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	out, err := format(name, data)
+	if err != nil {
+		return err
+	}
+	changed := !bytes.Equal(data, out)
+	if list && changed {
+		fmt.Println(name)
+	}
+	if write {
+		if changed {
+			return os.WriteFile(name, out, info.Mode().Perm())
+		}
+		return nil
+	}
+	if !list {
+		os.Stdout.Write(out)
+	}
+	return nil
+}
+
+func readAll(f *os.File) ([]byte, error) {
+	var b bytes.Buffer
+	_, err := b.ReadFrom(f)
+	return b.Bytes(), err
+}
+
+// format 逐行格式化，保留原来的换行符，出错时返回文件名和行号
+func format(name string, data []byte) ([]byte, error) {
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		cr := strings.HasSuffix(line, "\r")
+		s, err := gorules.FormatString(strings.TrimSuffix(line, "\r"))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, i+1, err)
+		}
+		if cr {
+			s += "\r"
+		}
+		lines[i] = s
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
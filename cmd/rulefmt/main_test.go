@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "one rule", in: "a>1&&IN(d,`x`)", want: `a > 1 && in(d, "x")`},
+		{name: "lines", in: "a>1\n\n  \nb<2\n", want: "a > 1\n\n  \nb < 2\n"},
+		{name: "crlf", in: "a>1\r\n\r\nb<2\r\n", want: "a > 1\r\n\r\nb < 2\r\n"},
+		{name: "formatted", in: "let m = a / 2; m > 1\n", want: "let m = a / 2; m > 1\n"},
+		{name: "error", in: "a > 1\na >\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := format("rules.txt", []byte(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("format() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatFile_keepMode(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "rules.txt")
+	if err := os.WriteFile(name, []byte("a>1\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := formatFile(name, true, false); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(name)
+	if info.Mode().Perm() != 0o600 || string(data) != "a > 1\r\n" {
+		t.Errorf("file mode = %v, content = %q", info.Mode().Perm(), data)
+	}
+}
@@ -0,0 +1,41 @@
+// rulegen 把规则生成为不使用反射的Go函数，适合配合go:generate使用：
+//
+//	//go:generate go run go-rules/cmd/rulegen -type Order -func IsBigOrder -rule "amount > 1000" -o order_rule.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	gorules "go-rules"
+)
+
+func main() {
+	var (
+		dir  = flag.String("dir", ".", "directory of the input type")
+		typ  = flag.String("type", "", "input struct type name")
+		fn   = flag.String("func", "", "generated function name")
+		rule = flag.String("rule", "", "rule expression")
+		out  = flag.String("o", "", "output file, default <type>_rule.go")
+		imp  = flag.String("import", "", "import path of the go-rules package, default go-rules")
+	)
+	flag.Parse()
+	if *typ == "" || *fn == "" || *rule == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *out == "" {
+		*out = strings.ToLower(*typ) + "_rule.go"
+	}
+	src, err := gorules.Generate(gorules.GenerateOptions{Dir: *dir, Type: *typ, Func: *fn, Rule: *rule, Import: *imp})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rulegen:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "rulegen:", err)
+		os.Exit(1)
+	}
+}
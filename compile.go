@@ -0,0 +1,427 @@
+package gorules
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// evalFunc 编译后的表达式，求值时直接调用，不再遍历ast
+type evalFunc func(c *evalContext) (value, error)
+
+// scope 编译期已定义的let变量及其在evalContext.locals中的下标
+type scope map[string]int
+
+// compiler 编译一条规则的状态，input不为nil时规则绑定了输入类型，
+// types保存类型检查得到的每个表达式的静态类型，nil表示运行时才能确定
+// consts保存编译时折叠出的常量，warnings是编译时发现的恒真、恒假条件，
+// net不为nil时在规则网络中共享子表达式
+type compiler struct {
+	scope    scope
+	input    reflect.Type
+	types    map[ast.Expr]reflect.Type
+	letTypes []reflect.Type
+	consts   map[ast.Expr]value
+	root     ast.Expr
+	warnings []string
+	net      *Network
+}
+
+// newCompiler 编译一条规则，input不为nil时做类型检查
+func newCompiler(input reflect.Type) *compiler {
+	cp := &compiler{scope: scope{}, input: input}
+	if input != nil {
+		cp.types = map[ast.Expr]reflect.Type{}
+	}
+	return cp
+}
+
+// build 绑定了输入类型时先做类型检查再编译，
+// root表示规则的结果表达式，结果是常量时报告警告
+func (cp *compiler) build(expr ast.Expr, root bool) (evalFunc, error) {
+	if root {
+		cp.root = unparen(expr)
+	}
+	if cp.input != nil {
+		if _, err := cp.check(expr); err != nil {
+			return nil, err
+		}
+	}
+	fn, err := cp.compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := cp.consts[expr]; ok && root {
+		cp.warnings = append(cp.warnings, fmt.Sprintf("rule is always %v", v.iface()))
+	}
+	return fn, nil
+}
+
+// compile 把表达式编译为闭包树：运算符、函数在编译期选定，字面量在编译期解析，
+// 编译规则网络时相同的子表达式共享一个节点
+func (cp *compiler) compile(expr ast.Expr) (evalFunc, error) {
+	if cp.net != nil {
+		if _, ok := expr.(*ast.ParenExpr); !ok {
+			return cp.net.node(cp, expr)
+		}
+	}
+	return cp.compileNode(expr)
+}
+
+func (cp *compiler) compileNode(expr ast.Expr) (evalFunc, error) {
+	switch t := expr.(type) {
+	case *ast.BinaryExpr:
+		return cp.compileBinary(t)
+	case *ast.Ident:
+		if _, ok := cp.scope[t.Name]; !ok && (t.Name == "true" || t.Name == "false") {
+			return cp.constant(t, boolValue(t.Name == "true")), nil
+		}
+		return cp.compileIdent(t), nil
+	case *ast.BasicLit:
+		v, err := parseLit(t)
+		if err != nil {
+			return failFunc(err), nil
+		}
+		return cp.constant(t, toValue(v)), nil
+	case *ast.ParenExpr:
+		fn, err := cp.compile(t.X)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := cp.consts[t.X]; ok {
+			return cp.constant(t, v), nil
+		}
+		return fn, nil
+	case *ast.SelectorExpr:
+		x, err := cp.compile(t.X)
+		if err != nil {
+			return nil, err
+		}
+		name := t.Sel.Name
+		step := func(c *evalContext) (value, error) {
+			v, err := x(c)
+			if err != nil {
+				return value{}, err
+			}
+			return lookupField(v.reflect(), name)
+		}
+		if idx, ok := fieldIndex(cp.types[t.X], name); ok {
+			step = func(c *evalContext) (value, error) {
+				v, err := x(c)
+				if err != nil {
+					return value{}, err
+				}
+				return fieldByIndex(v.reflect(), idx)
+			}
+		}
+		path, ok := cp.fieldPath(t)
+		if !ok {
+			return step, nil
+		}
+		if idx, ok := fieldIndex(cp.input, path); ok {
+			return func(c *evalContext) (value, error) {
+				return fieldByIndex(c.base, idx)
+			}, nil
+		}
+		// a.b.c直接按缓存的下标路径取值，base不是struct或路径不在缓存中时逐级取值
+		return func(c *evalContext) (value, error) {
+			if c.base.Kind() == reflect.Struct {
+				if idx, ok := cachedFields(c.base.Type())[path]; ok {
+					return fieldByIndex(c.base, idx)
+				}
+			}
+			return step(c)
+		}, nil
+	case *ast.IndexExpr:
+		return cp.compileIndex(t)
+	case *ast.CallExpr:
+		return cp.compileCall(t)
+	default:
+		return failFunc(ErrUnsupportExpr), nil
+	}
+}
+
+// fieldPath a.b.c形式的字段选择，返回“.”连接的路径
+func (cp *compiler) fieldPath(expr ast.Expr) (string, bool) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if _, ok := cp.consts[t]; ok {
+			return "", false
+		}
+		if _, ok := cp.scope[t.Name]; ok || strings.HasPrefix(t.Name, paramPrefix) {
+			return "", false
+		}
+		return t.Name, true
+	case *ast.SelectorExpr:
+		p, ok := cp.fieldPath(t.X)
+		if !ok {
+			return "", false
+		}
+		return p + "." + t.Sel.Name, true
+	default:
+		return "", false
+	}
+}
+
+func parseLit(t *ast.BasicLit) (interface{}, error) {
+	switch t.Kind {
+	case token.STRING:
+		return strconv.Unquote(t.Value)
+	case token.INT:
+		return strconv.ParseInt(t.Value, 10, 64)
+	case token.FLOAT:
+		return strconv.ParseFloat(t.Value, 64)
+	default:
+		return nil, errors.New("unsupport param")
+	}
+}
+
+func (cp *compiler) compileIdent(t *ast.Ident) evalFunc {
+	name := t.Name
+	if strings.HasPrefix(name, paramPrefix) {
+		name = name[len(paramPrefix):]
+		return func(c *evalContext) (value, error) {
+			return c.getVar(name)
+		}
+	}
+	if i, ok := cp.scope[name]; ok {
+		return func(c *evalContext) (value, error) {
+			return c.locals[i], nil
+		}
+	}
+	if idx, ok := fieldIndex(cp.input, name); ok {
+		return func(c *evalContext) (value, error) {
+			return fieldByIndex(c.base, idx)
+		}
+	}
+	return func(c *evalContext) (value, error) {
+		return lookupField(c.base, name)
+	}
+}
+
+func (cp *compiler) compileBinary(t *ast.BinaryExpr) (evalFunc, error) {
+	x, err := cp.compile(t.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := cp.compile(t.Y)
+	if err != nil {
+		return nil, err
+	}
+	switch t.Op {
+	case token.LAND, token.LOR:
+		return cp.compileLogic(t, x, y)
+	}
+	if f, ok := mathFuncs[t.Op]; ok {
+		return cp.fold(t, func(c *evalContext) (value, error) {
+			numx, numy, err := numberPair(c, x, y)
+			if err != nil {
+				return value{}, err
+			}
+			n, err := f(numx, numy)
+			if err != nil {
+				return value{}, err
+			}
+			return numberValue(n), nil
+		}, t.X, t.Y)
+	}
+	if f, ok := compareFuncs[t.Op]; ok {
+		op := t.Op
+		return cp.fold(t, func(c *evalContext) (value, error) {
+			xv, err := x(c)
+			if err != nil {
+				return value{}, err
+			}
+			yv, err := y(c)
+			if err != nil {
+				return value{}, err
+			}
+			return compareValues(xv, yv, op, f)
+		}, t.X, t.Y)
+	}
+	// 与原来一样，不支持的运算符在求值时报错
+	return func(c *evalContext) (value, error) {
+		if _, _, err := valuePair(c, x, y); err != nil {
+			return value{}, err
+		}
+		return value{}, ErrUnsupportToken
+	}, nil
+}
+
+// logicFunc && ||，两侧都先求值，任意一侧出错或不是bool时返回错误
+func logicFunc(x, y evalFunc, op token.Token) evalFunc {
+	return func(c *evalContext) (value, error) {
+		xv, yv, err := valuePair(c, x, y)
+		if err != nil {
+			return value{}, err
+		}
+		xb, ok := xv.boolean()
+		if !ok {
+			return value{}, ErrNotBool
+		}
+		yb, ok := yv.boolean()
+		if !ok {
+			return value{}, ErrNotBool
+		}
+		if op == token.LAND {
+			return boolValue(xb && yb), nil
+		}
+		return boolValue(xb || yb), nil
+	}
+}
+
+func valuePair(c *evalContext, x, y evalFunc) (value, value, error) {
+	xv, err := x(c)
+	if err != nil {
+		return value{}, value{}, err
+	}
+	yv, err := y(c)
+	if err != nil {
+		return value{}, value{}, err
+	}
+	return xv, yv, nil
+}
+
+// failFunc 不支持的表达式、函数与原来一样在求值时才报错
+func failFunc(err error) evalFunc {
+	return func(*evalContext) (value, error) { return value{}, err }
+}
+
+// mustBool 结果必须是bool，用于化简后的&& ||
+func mustBool(x evalFunc) evalFunc {
+	return func(c *evalContext) (value, error) {
+		v, err := x(c)
+		if err != nil {
+			return value{}, err
+		}
+		b, ok := v.boolean()
+		if !ok {
+			return value{}, ErrNotBool
+		}
+		return boolValue(b), nil
+	}
+}
+
+func numberPair(c *evalContext, x, y evalFunc) (float64, float64, error) {
+	xv, err := x(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	yv, err := y(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	return numbers(xv, yv)
+}
+
+func numbers(xv, yv value) (float64, float64, error) {
+	numx, err := xv.number()
+	if err != nil {
+		return 0, 0, err
+	}
+	numy, err := yv.number()
+	if err != nil {
+		return 0, 0, err
+	}
+	return numx, numy, nil
+}
+
+// compareValues 两侧都是字符串时按字符串比较，否则按数值比较
+func compareValues(xv, yv value, op token.Token, f func(x, y float64) bool) (value, error) {
+	if xs, ok := xv.string(); ok {
+		if ys, ok := yv.string(); ok {
+			b, err := compareString(xs, ys, op)
+			if err != nil {
+				return value{}, err
+			}
+			return boolValue(b), nil
+		}
+	}
+	numx, numy, err := numbers(xv, yv)
+	if err != nil {
+		return value{}, err
+	}
+	return boolValue(f(numx, numy)), nil
+}
+
+func (cp *compiler) compileIndex(t *ast.IndexExpr) (evalFunc, error) {
+	x, err := cp.compile(t.X)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := cp.compile(t.Index)
+	if err != nil {
+		return nil, err
+	}
+	return func(c *evalContext) (value, error) {
+		iv, err := idx(c)
+		if err != nil {
+			return value{}, err
+		}
+		if _, err := iv.number(); err != nil {
+			return value{}, ErrIndexNotNumber
+		}
+		v, err := x(c)
+		if err != nil {
+			return value{}, err
+		}
+		return indexValue(v, iv)
+	}, nil
+}
+
+// indexValue 按数值下标取slice、array的元素
+func indexValue(v, iv value) (value, error) {
+	f, err := iv.number()
+	if err != nil {
+		return value{}, ErrIndexNotNumber
+	}
+	return getSliceValue(v.reflect(), int(f))
+}
+
+// callError 只支持两个参数的IN函数，不区分大小写
+func callError(t *ast.CallExpr) error {
+	fexp, ok := t.Fun.(*ast.Ident)
+	if !ok {
+		return errors.New("unknow function")
+	}
+	if strings.ToUpper(fexp.Name) != "IN" {
+		return errors.New("unsupport function: " + fexp.Name)
+	}
+	if len(t.Args) != 2 {
+		return errors.New("function IN only support tow params")
+	}
+	return nil
+}
+
+func (cp *compiler) compileCall(t *ast.CallExpr) (evalFunc, error) {
+	if err := callError(t); err != nil {
+		return failFunc(err), nil
+	}
+	slice, err := cp.compile(t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	key, err := cp.compile(t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return func(c *evalContext) (value, error) {
+		sv, err := slice(c)
+		if err != nil {
+			return value{}, err
+		}
+		kv, err := key(c)
+		if err != nil {
+			return value{}, err
+		}
+		b, err := isIn(sv, kv)
+		if err != nil {
+			return value{}, err
+		}
+		return boolValue(b), nil
+	}, nil
+}
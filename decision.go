@@ -0,0 +1,570 @@
+package gorules
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HitPolicy 决策表有多行匹配时的处理方式
+type HitPolicy int
+
+const (
+	// HitFirst 按行的顺序返回第一条匹配的行
+	HitFirst HitPolicy = iota
+	// HitUnique 最多只能有一行匹配，多行匹配时返回ErrNotUnique
+	HitUnique
+	// HitCollect 按行的顺序返回所有匹配的行
+	HitCollect
+	// HitPriority 返回匹配的行中Priority最大的一行，相同时取靠前的行
+	HitPriority
+)
+
+// DecisionTable 决策表的定义：Inputs是条件列的表达式，Outputs是结果列的名字，
+// 每一行的When与Inputs一一对应，Then与Outputs一一对应。
+//
+// 条件单元格的写法：
+//
+//	空或-           任意值
+//	18              等于，字符串可以加引号也可以不加：north、"north"
+//	north, south    等于其中之一
+//	>= 18           比较，支持 < <= > >= =
+//	[18..30)        区间，[ ]包含端点，( )不包含端点
+//
+// 结果单元格是规则表达式，字符串需要加引号，空的结果为nil
+type DecisionTable struct {
+	Inputs  []string
+	Outputs []string
+	Rows    []DecisionRow
+	Policy  HitPolicy
+}
+
+// DecisionRow 决策表的一行
+type DecisionRow struct {
+	When     []string
+	Then     []string
+	Priority int
+}
+
+// DecisionHit 匹配的行，Row是行在Rows中的下标
+type DecisionHit struct {
+	Row     int
+	Outputs map[string]interface{}
+}
+
+// CompiledTable 编译好的决策表，每行的条件编译为一条规则
+type CompiledTable struct {
+	table DecisionTable
+	cells [][]cell
+	conds []Rule
+	outs  [][]Rule
+}
+
+// Compile 解析条件单元格，把每行编译为规则
+func (t DecisionTable) Compile() (*CompiledTable, error) {
+	ct := &CompiledTable{table: t}
+	for i, row := range t.Rows {
+		if len(row.When) != len(t.Inputs) || len(row.Then) != len(t.Outputs) {
+			return nil, fmt.Errorf("row %d: want %d conditions and %d outputs", i+1, len(t.Inputs), len(t.Outputs))
+		}
+		cells := make([]cell, len(row.When))
+		var conds []string
+		for j, src := range row.When {
+			c, err := parseCell(src)
+			if err != nil {
+				return nil, fmt.Errorf("row %d column %s: %w", i+1, t.Inputs[j], err)
+			}
+			cells[j] = c
+			if !c.any {
+				conds = append(conds, c.expr(t.Inputs[j]))
+			}
+		}
+		if len(conds) == 0 {
+			conds = append(conds, "true")
+		}
+		cond, err := NewRule(strings.Join(conds, " && "))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		outs := make([]Rule, len(row.Then))
+		for j, src := range row.Then {
+			if strings.TrimSpace(src) == "" {
+				continue
+			}
+			if outs[j], err = NewRule(src); err != nil {
+				return nil, fmt.Errorf("row %d output %s: %w", i+1, t.Outputs[j], err)
+			}
+		}
+		ct.cells = append(ct.cells, cells)
+		ct.conds = append(ct.conds, cond)
+		ct.outs = append(ct.outs, outs)
+	}
+	for j, in := range t.Inputs {
+		var num, str bool
+		for _, cells := range ct.cells {
+			num = num || len(cells[j].intervals) > 0
+			str = str || len(cells[j].strs) > 0
+		}
+		if num && str {
+			return nil, fmt.Errorf("column %s: %w: mixed numbers and strings", in, ErrInvalidCell)
+		}
+	}
+	return ct, nil
+}
+
+// Eval 按HitPolicy返回匹配的行，HitCollect以外最多返回一行，没有匹配时返回空
+func (t *CompiledTable) Eval(x interface{}) ([]DecisionHit, error) {
+	var rows []int
+	for i, c := range t.conds {
+		ok, err := c.Bool(x)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if !ok {
+			continue
+		}
+		rows = append(rows, i)
+		if t.table.Policy == HitFirst {
+			break
+		}
+	}
+	switch t.table.Policy {
+	case HitUnique:
+		if len(rows) > 1 {
+			return nil, fmt.Errorf("%w: rows %s", ErrNotUnique, rowList(rows))
+		}
+	case HitPriority:
+		for _, i := range rows {
+			if t.table.Rows[i].Priority > t.table.Rows[rows[0]].Priority {
+				rows[0] = i
+			}
+		}
+		if len(rows) > 1 {
+			rows = rows[:1]
+		}
+	}
+	hits := make([]DecisionHit, 0, len(rows))
+	for _, i := range rows {
+		h := DecisionHit{Row: i, Outputs: make(map[string]interface{}, len(t.table.Outputs))}
+		for j, name := range t.table.Outputs {
+			if t.outs[i][j] == nil {
+				h.Outputs[name] = nil
+				continue
+			}
+			v, err := t.outs[i][j].Eval(x)
+			if err != nil {
+				return nil, fmt.Errorf("row %d output %s: %w", i+1, name, err)
+			}
+			h.Outputs[name] = v
+		}
+		hits = append(hits, h)
+	}
+	return hits, nil
+}
+
+// Overlaps 可能同时匹配的行，HitUnique的决策表不应有重叠
+func (t *CompiledTable) Overlaps() []string {
+	var overlaps []string
+	for a := range t.cells {
+		for b := a + 1; b < len(t.cells); b++ {
+			overlap := true
+			for j := range t.table.Inputs {
+				if !t.cells[a][j].intersects(t.cells[b][j]) {
+					overlap = false
+					break
+				}
+			}
+			if overlap {
+				overlaps = append(overlaps, fmt.Sprintf("rows %d and %d overlap", a+1, b+1))
+			}
+		}
+	}
+	return overlaps
+}
+
+// maxGaps 最多报告的空缺个数
+const maxGaps = 20
+
+// Gaps 没有任何行匹配的输入区域。数值列按所有端点划分区间，
+// 字符串列按出现过的值划分，other表示没有出现过的值
+func (t *CompiledTable) Gaps() []string {
+	rows := make([]int, len(t.cells))
+	for i := range rows {
+		rows[i] = i
+	}
+	var gaps []string
+	t.findGaps(0, rows, nil, &gaps)
+	return gaps
+}
+
+func (t *CompiledTable) findGaps(col int, rows []int, prefix []string, gaps *[]string) {
+	if len(*gaps) >= maxGaps {
+		return
+	}
+	if len(rows) == 0 {
+		desc := strings.Join(prefix, ", ")
+		if desc == "" {
+			desc = "any input"
+		}
+		*gaps = append(*gaps, "no row matches "+desc)
+		return
+	}
+	if col == len(t.table.Inputs) {
+		return
+	}
+	for _, r := range t.regions(col) {
+		var covered []int
+		for _, i := range rows {
+			if t.cells[i][col].covers(r) {
+				covered = append(covered, i)
+			}
+		}
+		next := prefix
+		if r.desc != "" {
+			next = append(prefix[:len(prefix):len(prefix)], r.desc)
+		}
+		t.findGaps(col+1, covered, next, gaps)
+	}
+}
+
+// region 一列取值的一个划分，只用代表值判断单元格是否覆盖
+type region struct {
+	num   float64
+	str   string
+	other bool
+	desc  string
+}
+
+func (t *CompiledTable) regions(col int) []region {
+	name := t.table.Inputs[col]
+	var points []float64
+	strs := map[string]bool{}
+	for _, cells := range t.cells {
+		for _, iv := range cells[col].intervals {
+			for _, p := range []float64{iv.lo, iv.hi} {
+				if !math.IsInf(p, 0) {
+					points = append(points, p)
+				}
+			}
+		}
+		for _, s := range cells[col].strs {
+			strs[s] = true
+		}
+	}
+	if len(strs) > 0 {
+		var values []string
+		for s := range strs {
+			values = append(values, s)
+		}
+		sort.Strings(values)
+		regions := make([]region, 0, len(values)+1)
+		for _, s := range values {
+			regions = append(regions, region{str: s, desc: fmt.Sprintf("%s = %q", name, s)})
+		}
+		return append(regions, region{other: true, desc: name + " = other"})
+	}
+	if len(points) == 0 {
+		return []region{{}}
+	}
+	sort.Float64s(points)
+	uniq := points[:1]
+	for _, p := range points[1:] {
+		if p != uniq[len(uniq)-1] {
+			uniq = append(uniq, p)
+		}
+	}
+	regions := []region{{num: uniq[0] - 1, desc: fmt.Sprintf("%s < %v", name, uniq[0])}}
+	for i, p := range uniq {
+		regions = append(regions, region{num: p, desc: fmt.Sprintf("%s = %v", name, p)})
+		if i+1 < len(uniq) {
+			regions = append(regions, region{num: (p + uniq[i+1]) / 2, desc: fmt.Sprintf("%v < %s < %v", p, name, uniq[i+1])})
+		}
+	}
+	last := uniq[len(uniq)-1]
+	return append(regions, region{num: last + 1, desc: fmt.Sprintf("%s > %v", name, last)})
+}
+
+func rowList(rows []int) string {
+	s := make([]string, len(rows))
+	for i, r := range rows {
+		s[i] = strconv.Itoa(r + 1)
+	}
+	return strings.Join(s, ", ")
+}
+
+// cell 条件单元格：any表示任意值，数值条件是若干区间，字符串条件是取值集合
+type cell struct {
+	any       bool
+	intervals []interval
+	strs      []string
+}
+
+// interval 数值区间，端点可以是无穷
+type interval struct {
+	lo, hi         float64
+	loOpen, hiOpen bool
+}
+
+func point(f float64) interval {
+	return interval{lo: f, hi: f}
+}
+
+func (iv interval) contains(f float64) bool {
+	return (f > iv.lo || f == iv.lo && !iv.loOpen) && (f < iv.hi || f == iv.hi && !iv.hiOpen)
+}
+
+func (iv interval) intersects(o interval) bool {
+	lo, hi := math.Max(iv.lo, o.lo), math.Min(iv.hi, o.hi)
+	loOpen := iv.lo == lo && iv.loOpen || o.lo == lo && o.loOpen
+	hiOpen := iv.hi == hi && iv.hiOpen || o.hi == hi && o.hiOpen
+	return lo < hi || lo == hi && !loOpen && !hiOpen
+}
+
+func (c cell) covers(r region) bool {
+	switch {
+	case c.any:
+		return true
+	case r.other:
+		return false
+	case len(c.strs) > 0:
+		for _, s := range c.strs {
+			if s == r.str {
+				return true
+			}
+		}
+		return false
+	}
+	for _, iv := range c.intervals {
+		if iv.contains(r.num) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c cell) intersects(o cell) bool {
+	if c.any || o.any {
+		return true
+	}
+	for _, s := range c.strs {
+		for _, t := range o.strs {
+			if s == t {
+				return true
+			}
+		}
+	}
+	for _, a := range c.intervals {
+		for _, b := range o.intervals {
+			if a.intersects(b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expr 单元格对应的规则表达式
+func (c cell) expr(input string) string {
+	in := "(" + input + ")"
+	var or []string
+	for _, s := range c.strs {
+		or = append(or, in+" == "+strconv.Quote(s))
+	}
+	for _, iv := range c.intervals {
+		if iv.lo == iv.hi {
+			or = append(or, in+" == "+numberLit(iv.lo))
+			continue
+		}
+		var and []string
+		if !math.IsInf(iv.lo, -1) {
+			op := " >= "
+			if iv.loOpen {
+				op = " > "
+			}
+			and = append(and, in+op+numberLit(iv.lo))
+		}
+		if !math.IsInf(iv.hi, 1) {
+			op := " <= "
+			if iv.hiOpen {
+				op = " < "
+			}
+			and = append(and, in+op+numberLit(iv.hi))
+		}
+		or = append(or, strings.Join(and, " && "))
+	}
+	if len(or) == 1 {
+		return or[0]
+	}
+	return "(" + strings.Join(or, " || ") + ")"
+}
+
+// numberLit 规则不支持一元负号，负数写成常量减法，编译时折叠
+func numberLit(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if f < 0 {
+		return "(0 - " + s[1:] + ")"
+	}
+	return s
+}
+
+func parseCell(src string) (cell, error) {
+	s := strings.TrimSpace(src)
+	if s == "" || s == "-" {
+		return cell{any: true}, nil
+	}
+	if (s[0] == '[' || s[0] == '(') && strings.Contains(s, "..") {
+		end := s[len(s)-1]
+		bounds := strings.SplitN(s[1:len(s)-1], "..", 2)
+		lo, err1 := parseNumber(bounds[0])
+		hi, err2 := parseNumber(bounds[1])
+		loOpen, hiOpen := s[0] == '(', end == ')'
+		// [5..5)、(5..5)等空区间不匹配任何值，视为写错
+		if (end != ']' && end != ')') || err1 != nil || err2 != nil || lo > hi || lo == hi && (loOpen || hiOpen) {
+			return cell{}, fmt.Errorf("%w: %s", ErrInvalidCell, src)
+		}
+		return cell{intervals: []interval{{lo: lo, hi: hi, loOpen: loOpen, hiOpen: hiOpen}}}, nil
+	}
+	for _, op := range []string{"<=", ">=", "==", "<", ">", "="} {
+		if !strings.HasPrefix(s, op) {
+			continue
+		}
+		rest := strings.TrimSpace(s[len(op):])
+		if op == "=" || op == "==" {
+			return parseValues(rest, src)
+		}
+		f, err := parseNumber(rest)
+		if err != nil {
+			return cell{}, fmt.Errorf("%w: %s", ErrInvalidCell, src)
+		}
+		iv := interval{lo: math.Inf(-1), hi: math.Inf(1), loOpen: true, hiOpen: true}
+		switch op {
+		case "<", "<=":
+			iv.hi, iv.hiOpen = f, op == "<"
+		default:
+			iv.lo, iv.loOpen = f, op == ">"
+		}
+		return cell{intervals: []interval{iv}}, nil
+	}
+	return parseValues(s, src)
+}
+
+// parseNumber 单元格中的数值，NaN、Inf与任何值比较的结果都不可靠，视为错误
+func parseNumber(s string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err == nil && !finite(f) {
+		err = ErrInvalidCell
+	}
+	return f, err
+}
+
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// parseValues 逗号分隔的取值列表，数值和字符串不能混用
+func parseValues(s, src string) (cell, error) {
+	var c cell
+	for _, lit := range splitList(s) {
+		lit = strings.TrimSpace(lit)
+		if f, err := strconv.ParseFloat(lit, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+			if err != nil || !finite(f) {
+				return cell{}, fmt.Errorf("%w: %s", ErrInvalidCell, src)
+			}
+			c.intervals = append(c.intervals, point(f))
+			continue
+		}
+		if strings.HasPrefix(lit, `"`) {
+			u, err := strconv.Unquote(lit)
+			if err != nil {
+				return cell{}, fmt.Errorf("%w: %s", ErrInvalidCell, src)
+			}
+			lit = u
+		} else if lit == "" || lit == "true" || lit == "false" || strings.ContainsAny(lit, "<>=()[]") {
+			return cell{}, fmt.Errorf("%w: %s", ErrInvalidCell, src)
+		}
+		c.strs = append(c.strs, lit)
+	}
+	if len(c.intervals) > 0 && len(c.strs) > 0 {
+		return cell{}, fmt.Errorf("%w: mixed numbers and strings: %s", ErrInvalidCell, src)
+	}
+	return c, nil
+}
+
+// splitList 按逗号拆分，引号中的逗号不受影响
+func splitList(s string) []string {
+	var list []string
+	quoted, escaped, last := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\' && quoted:
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ',' && !quoted:
+			list = append(list, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(list, s[last:])
+}
+
+// 决策表CSV中的特殊表头
+const (
+	csvOutputPrefix = "out:"
+	csvPriority     = "#priority"
+)
+
+// ReadDecisionCSV 从CSV读取决策表，第一行是表头：以out:开头的列是结果列，
+// #priority列是行的优先级，其余列是条件列，表头是条件的表达式。HitPolicy由调用方设置
+func ReadDecisionCSV(r io.Reader) (DecisionTable, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return DecisionTable{}, err
+	}
+	if len(records) == 0 {
+		return DecisionTable{}, fmt.Errorf("decision table csv: missing header")
+	}
+	var t DecisionTable
+	kinds := make([]byte, len(records[0]))
+	for i, h := range records[0] {
+		h = strings.TrimSpace(h)
+		switch {
+		case h == csvPriority:
+			kinds[i] = 'p'
+		case strings.HasPrefix(h, csvOutputPrefix):
+			kinds[i] = 'o'
+			t.Outputs = append(t.Outputs, strings.TrimSpace(h[len(csvOutputPrefix):]))
+		default:
+			kinds[i] = 'i'
+			t.Inputs = append(t.Inputs, h)
+		}
+	}
+	for n, rec := range records[1:] {
+		var row DecisionRow
+		for i, v := range rec {
+			switch kinds[i] {
+			case 'p':
+				if v = strings.TrimSpace(v); v != "" {
+					if row.Priority, err = strconv.Atoi(v); err != nil {
+						return DecisionTable{}, fmt.Errorf("decision table csv line %d: invalid priority %q", n+2, v)
+					}
+				}
+			case 'o':
+				row.Then = append(row.Then, v)
+			default:
+				row.When = append(row.When, v)
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t, nil
+}
@@ -0,0 +1,184 @@
+package gorules
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type applicant struct {
+	Age    int     `json:"age"`
+	Region string  `json:"region"`
+	Score  float64 `json:"score"`
+}
+
+const policyCSV = `age,region,score,#priority,out:tier,out:rate
+< 18,-,-,0,"""none""",0
+[18..60),"north, south",>= 700,1,"""gold""",score / 1000
+[18..60),"north, south",< 700,0,"""silver""",0.5
+>= 60,-,-,2,"""senior""",0.3
+`
+
+func TestDecisionTable_Eval(t *testing.T) {
+	table, err := ReadDecisionCSV(strings.NewReader(policyCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table.Inputs, []string{"age", "region", "score"}) || !reflect.DeepEqual(table.Outputs, []string{"tier", "rate"}) {
+		t.Fatalf("ReadDecisionCSV() inputs = %v, outputs = %v", table.Inputs, table.Outputs)
+	}
+	tests := []struct {
+		name    string
+		policy  HitPolicy
+		x       applicant
+		want    []map[string]interface{}
+		wantErr error
+	}{
+		{name: "minor", x: applicant{Age: 10}, want: []map[string]interface{}{{"tier": "none", "rate": int64(0)}}},
+		{name: "gold", x: applicant{Age: 30, Region: "north", Score: 800}, want: []map[string]interface{}{{"tier": "gold", "rate": 0.8}}},
+		{name: "silver", x: applicant{Age: 59, Region: "south", Score: 699}, want: []map[string]interface{}{{"tier": "silver", "rate": 0.5}}},
+		{name: "other region", x: applicant{Age: 30, Region: "east", Score: 800}, want: []map[string]interface{}{}},
+		{name: "senior", policy: HitUnique, x: applicant{Age: 60}, want: []map[string]interface{}{{"tier": "senior", "rate": 0.3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table.Policy = tt.policy
+			ct, err := table.Compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			hits, err := ct.Eval(tt.x)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Eval() error = %v, want %v", err, tt.wantErr)
+			}
+			got := []map[string]interface{}{}
+			for _, h := range hits {
+				got = append(got, h.Outputs)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecisionTable_policy(t *testing.T) {
+	table := DecisionTable{
+		Inputs:  []string{"score"},
+		Outputs: []string{"level"},
+		Rows: []DecisionRow{
+			{When: []string{">= 0"}, Then: []string{"1"}},
+			{When: []string{">= 50"}, Then: []string{"2"}, Priority: 5},
+			{When: []string{">= 90"}, Then: []string{"3"}, Priority: 5},
+		},
+	}
+	tests := []struct {
+		policy  HitPolicy
+		want    []int
+		wantErr error
+	}{
+		{policy: HitFirst, want: []int{0}},
+		{policy: HitCollect, want: []int{0, 1, 2}},
+		{policy: HitPriority, want: []int{1}},
+		{policy: HitUnique, wantErr: ErrNotUnique},
+	}
+	for _, tt := range tests {
+		table.Policy = tt.policy
+		ct, err := table.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hits, err := ct.Eval(applicant{Score: 95})
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("policy %d Eval() error = %v, want %v", tt.policy, err, tt.wantErr)
+		}
+		var rows []int
+		for _, h := range hits {
+			rows = append(rows, h.Row)
+		}
+		if !reflect.DeepEqual(rows, tt.want) {
+			t.Errorf("policy %d Eval() rows = %v, want %v", tt.policy, rows, tt.want)
+		}
+	}
+}
+
+func TestDecisionTable_validate(t *testing.T) {
+	table, err := ReadDecisionCSV(strings.NewReader(policyCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := table.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ct.Overlaps(); len(got) != 0 {
+		t.Errorf("Overlaps() = %v, want none", got)
+	}
+	want := []string{`no row matches 18 < age < 60, region = other`, `no row matches age = 18, region = other`}
+	gaps := ct.Gaps()
+	for _, w := range want {
+		found := false
+		for _, g := range gaps {
+			found = found || g == w
+		}
+		if !found {
+			t.Errorf("Gaps() = %v, want %q", gaps, w)
+		}
+	}
+	if len(gaps) != 2 {
+		t.Errorf("Gaps() = %v, want 2 gaps", gaps)
+	}
+
+	table.Rows[3].When[0] = "[59..100]"
+	table.Rows[0].When[0] = "(-1..18)"
+	ct, _ = table.Compile()
+	if got := ct.Overlaps(); !reflect.DeepEqual(got, []string{"rows 2 and 4 overlap", "rows 3 and 4 overlap"}) {
+		t.Errorf("Overlaps() = %v", got)
+	}
+	if gaps := ct.Gaps(); len(gaps) == 0 || gaps[0] != "no row matches age < -1" {
+		t.Errorf("Gaps() = %v", gaps)
+	}
+}
+
+func TestDecisionTable_compileError(t *testing.T) {
+	tests := []DecisionTable{
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"[1..0]"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"[1..2"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"[5..5)"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"(5..5)"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"(5..5]"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"> x"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"nan"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"1, NaN"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"= inf"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"Infinity"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"1e400"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"> -Inf"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"[nan..1]"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"[0..inf)"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"1, x"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"true"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"1"}}, {When: []string{"x"}}}},
+		{Inputs: []string{"a"}, Rows: []DecisionRow{{When: []string{"1", "2"}}}},
+		{Inputs: []string{"a"}, Outputs: []string{"o"}, Rows: []DecisionRow{{When: []string{"1"}, Then: []string{"a +"}}}},
+	}
+	for i, tt := range tests {
+		if _, err := tt.Compile(); err == nil {
+			t.Errorf("table %d Compile() want error", i)
+		}
+	}
+	point := DecisionTable{Inputs: []string{"a"}, Outputs: []string{"o"}, Rows: []DecisionRow{{When: []string{"[5..5]"}, Then: []string{"1"}}}}
+	ct, err := point.Compile()
+	if err != nil {
+		t.Fatalf("[5..5] Compile() error = %v", err)
+	}
+	for a, want := range map[int64]int{4: 0, 5: 1, 6: 0} {
+		if hits, err := ct.Eval(evalType{A: a}); err != nil || len(hits) != want {
+			t.Errorf("[5..5] Eval(%d) = %v, %v, want %d hits", a, hits, err, want)
+		}
+	}
+	if _, err := ReadDecisionCSV(strings.NewReader("a,#priority\n1,x\n")); err == nil {
+		t.Errorf("ReadDecisionCSV() want priority error")
+	}
+}
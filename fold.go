@@ -0,0 +1,106 @@
+package gorules
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// constant 记录编译时已知的常量
+func (cp *compiler) constant(expr ast.Expr, v value) evalFunc {
+	if cp.consts == nil {
+		cp.consts = map[ast.Expr]value{}
+	}
+	cp.consts[expr] = v
+	return func(*evalContext) (value, error) { return v, nil }
+}
+
+// fold 操作数都是常量时在编译时计算，常量表达式出错（如除以0）时报告警告，
+// 与不折叠时一样在求值时返回错误
+func (cp *compiler) fold(expr ast.Expr, fn evalFunc, operands ...ast.Expr) (evalFunc, error) {
+	for _, o := range operands {
+		if _, ok := cp.consts[o]; !ok {
+			return fn, nil
+		}
+	}
+	v, err := fn(&evalContext{})
+	if err != nil {
+		cp.warnings = append(cp.warnings, fmt.Sprintf("%s always fails: %v", exprString(expr), err))
+		return failFunc(err), nil
+	}
+	return cp.constant(expr, v), nil
+}
+
+// compileLogic 编译&& ||，一侧是常量时化简，另一侧仍然求值，出错时照常返回错误：
+//
+//	true && x, x && true, false || x, x || false  =>  x
+//	false && x, true || x, x && false, x || true  =>  x没有出错时恒为常量
+//
+// 常量一侧不是bool时报告警告，求值时返回ErrNotBool
+func (cp *compiler) compileLogic(t *ast.BinaryExpr, x, y evalFunc) (evalFunc, error) {
+	short := t.Op == token.LOR
+	xc, xok := cp.consts[t.X]
+	yc, yok := cp.consts[t.Y]
+	if xok {
+		xb, ok := xc.boolean()
+		if !ok {
+			return cp.warnNotBool(t, t.X, x, y), nil
+		}
+		if xb == short {
+			if !yok {
+				cp.warnAlways(t, short)
+				return logicFunc(x, y, t.Op), nil
+			}
+			if _, ok := yc.boolean(); !ok {
+				return cp.warnNotBool(t, t.Y, x, y), nil
+			}
+			if t != cp.root {
+				cp.warnAlways(t, short)
+			}
+			return cp.constant(t, boolValue(short)), nil
+		}
+		if yok {
+			return cp.fold(t, mustBool(y), t.Y)
+		}
+		return mustBool(y), nil
+	}
+	if yok {
+		yb, ok := yc.boolean()
+		if !ok {
+			return cp.warnNotBool(t, t.Y, x, y), nil
+		}
+		if yb == short {
+			cp.warnAlways(t, short)
+			return logicFunc(x, y, t.Op), nil
+		}
+		return mustBool(x), nil
+	}
+	return logicFunc(x, y, t.Op), nil
+}
+
+func (cp *compiler) warnAlways(expr ast.Expr, v bool) {
+	cp.warnings = append(cp.warnings, fmt.Sprintf("%s is always %v", exprString(expr), v))
+}
+
+// warnNotBool 常量操作数不是bool，两侧照常求值后返回ErrNotBool
+func (cp *compiler) warnNotBool(t *ast.BinaryExpr, operand ast.Expr, x, y evalFunc) evalFunc {
+	cp.warnings = append(cp.warnings, fmt.Sprintf("%s always fails: %v: %s", exprString(t), ErrNotBool, exprString(operand)))
+	return logicFunc(x, y, t.Op)
+}
+
+// exprString 表达式的文本，外部参数还原为$name
+func exprString(expr ast.Expr) string {
+	return strings.ReplaceAll(types.ExprString(expr), paramPrefix, "$")
+}
+
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		p, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = p.X
+	}
+}
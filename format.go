@@ -0,0 +1,112 @@
+package gorules
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// Format 把NewRule、NewRuleFor创建的规则输出为规范格式的文本，
+// 再次编译得到的规则与原规则相同
+func Format(r Rule) (string, error) {
+	ru, ok := r.(*rule)
+	if !ok {
+		return "", fmt.Errorf("%w: unsupport rule type %T", ErrInvalidAST, r)
+	}
+	var b strings.Builder
+	for _, l := range ru.lets {
+		b.WriteString("let " + l.name + " = ")
+		writeExpr(&b, l.expr, 0)
+		b.WriteString("; ")
+	}
+	writeExpr(&b, ru.expr, 0)
+	return b.String(), nil
+}
+
+// FormatString 编译规则文本后输出规范格式
+func FormatString(src string) (string, error) {
+	r, err := NewRule(src)
+	if err != nil {
+		return "", err
+	}
+	return Format(r)
+}
+
+// exprText 按规范格式输出表达式：二元运算符两侧各一个空格，只保留优先级需要的括号，
+// 外部参数写作$name，字符串用双引号，函数名小写
+func exprText(expr ast.Expr) string {
+	var b strings.Builder
+	writeExpr(&b, expr, 0)
+	return b.String()
+}
+
+// writeExpr prec是当前位置不加括号时允许的最低优先级
+func writeExpr(b *strings.Builder, expr ast.Expr, prec int) {
+	switch t := expr.(type) {
+	case *ast.ParenExpr:
+		writeExpr(b, t.X, prec)
+	case *ast.BinaryExpr:
+		p := t.Op.Precedence()
+		if p < prec {
+			b.WriteByte('(')
+		}
+		// 运算都是左结合，右侧相同优先级的运算需要括号
+		writeExpr(b, t.X, p)
+		b.WriteString(" " + t.Op.String() + " ")
+		writeExpr(b, t.Y, p+1)
+		if p < prec {
+			b.WriteByte(')')
+		}
+	case *ast.Ident:
+		if strings.HasPrefix(t.Name, paramPrefix) {
+			b.WriteString("$" + t.Name[len(paramPrefix):])
+			return
+		}
+		b.WriteString(t.Name)
+	case *ast.BasicLit:
+		// JSON AST中的负数字面量，规则文本不支持一元负号，写成0减去它的绝对值
+		if strings.HasPrefix(t.Value, "-") {
+			writeExpr(b, negative(&ast.BasicLit{Kind: t.Kind, Value: t.Value[1:]}).expr, prec)
+			return
+		}
+		// 没有小数点的浮点数再次解析会变成整数
+		if t.Kind == token.FLOAT && !strings.ContainsAny(t.Value, ".eEpPxX") {
+			b.WriteString(t.Value + ".0")
+			return
+		}
+		if t.Kind == token.STRING {
+			if s, err := strconv.Unquote(t.Value); err == nil {
+				b.WriteString(strconv.Quote(s))
+				return
+			}
+		}
+		b.WriteString(t.Value)
+	case *ast.SelectorExpr:
+		writeExpr(b, t.X, token.HighestPrec+1)
+		b.WriteString("." + t.Sel.Name)
+	case *ast.IndexExpr:
+		writeExpr(b, t.X, token.HighestPrec+1)
+		b.WriteByte('[')
+		writeExpr(b, t.Index, 0)
+		b.WriteByte(']')
+	case *ast.CallExpr:
+		if f, ok := t.Fun.(*ast.Ident); ok {
+			b.WriteString(strings.ToLower(f.Name))
+		} else {
+			writeExpr(b, t.Fun, token.HighestPrec+1)
+		}
+		b.WriteByte('(')
+		for i, a := range t.Args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeExpr(b, a, 0)
+		}
+		b.WriteByte(')')
+	default:
+		b.WriteString(types.ExprString(expr))
+	}
+}
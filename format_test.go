@@ -0,0 +1,66 @@
+package gorules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFormatString(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{src: `a>1&&IN(d,"x")`, want: `a > 1 && in(d, "x")`},
+		{src: "((a + b)) * 2", want: `(a + b) * 2`},
+		{src: "a + (b * 2)", want: `a + b * 2`},
+		{src: "(a - b) - 1", want: `a - b - 1`},
+		{src: "a - (b - 1)", want: `a - (b - 1)`},
+		{src: "a < 1 || (true && c == `x`)", want: `a < 1 || true && c == "x"`},
+		{src: "(a < 1 || true) && $x", want: `(a < 1 || true) && $x`},
+		{src: "  f.z[ 0 ]==$name ", want: `f.z[0] == $name`},
+		{src: "let m=a/2;let n = (m+b) ;n>=3", want: `let m = a / 2; let n = m + b; n >= 3`},
+	}
+	for _, tt := range tests {
+		got, err := FormatString(tt.src)
+		if err != nil {
+			t.Fatalf("FormatString(%s) error = %v", tt.src, err)
+		}
+		if got != tt.want {
+			t.Errorf("FormatString(%s) = %s, want %s", tt.src, got, tt.want)
+		}
+		again, err := FormatString(got)
+		if err != nil || again != got {
+			t.Errorf("FormatString(%s) = %s, %v, not stable", got, again, err)
+		}
+	}
+	if _, err := FormatString("a >"); err == nil {
+		t.Errorf("FormatString() want error")
+	}
+}
+
+func TestFormat_ast(t *testing.T) {
+	r, err := UnmarshalRule([]byte(`{"version":1,"expr":{"kind":"binary","op":"<","args":[` +
+		`{"kind":"binary","op":"*","args":[{"kind":"field","name":"b"},{"kind":"float","value":2}]},{"kind":"int","value":-3}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Format(r)
+	if want := `b * 2.0 < 0 - 3`; got != want || err != nil {
+		t.Fatalf("Format() = %s, %v, want %s", got, err, want)
+	}
+	parsed, err := NewRule(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Env{Input: evalType{B: -2}}
+	v1, err1 := r.Eval(env)
+	v2, err2 := parsed.Eval(env)
+	if !reflect.DeepEqual(v1, v2) || err1 != nil || err2 != nil {
+		t.Errorf("Eval() = %v, %v, want %v, %v", v2, err2, v1, err1)
+	}
+	p, _ := NewProgram("a > 1")
+	if _, err := Format(p); !errors.Is(err, ErrInvalidAST) {
+		t.Errorf("Format(Program) error = %v", err)
+	}
+}
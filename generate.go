@@ -0,0 +1,562 @@
+package gorules
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// defaultImportPath 生成的代码默认通过该路径引用本包的错误定义
+const defaultImportPath = "go-rules"
+
+// GenerateOptions 代码生成参数
+type GenerateOptions struct {
+	Dir    string // 输入类型所在的源码目录，默认当前目录
+	Type   string // 输入类型名，必须是Dir下定义的struct
+	Func   string // 生成的函数名
+	Rule   string // 规则，不支持$name外部参数
+	Import string // 本包的导入路径，默认go-rules
+}
+
+// Generate 把规则生成为普通的Go函数 func Func(x *Type) (bool, error)，语义与Rule.Bool一致，
+// 运行时不使用反射。生成的代码直接引用Go字段名，类型改名、删字段后重新编译就会报错
+func Generate(opts GenerateOptions) ([]byte, error) {
+	if opts.Dir == "" {
+		opts.Dir = "."
+	}
+	if opts.Import == "" {
+		opts.Import = defaultImportPath
+	}
+	pkg, types, err := parseTypes(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := types[opts.Type]
+	if !ok {
+		return nil, fmt.Errorf("type %s not found in %s", opts.Type, opts.Dir)
+	}
+	ru, err := newRule(opts.Rule, nil)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{types: types, lets: map[string]genValue{}}
+	input, err := g.resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+	if input.kind != genStruct {
+		return nil, fmt.Errorf("type %s must be struct", opts.Type)
+	}
+	// x在函数开头已经检查过nil
+	g.input = genValue{expr: "x", typ: input}
+
+	var lets []string
+	for _, l := range ru.lets {
+		v, err := g.gen(l.expr)
+		if err != nil {
+			return nil, err
+		}
+		name := g.tmp()
+		g.line("%s := %s // let %s", name, v.expr, l.name)
+		g.lets[l.name] = genValue{expr: name, typ: v.typ}
+		lets = append(lets, name)
+	}
+	v, err := g.gen(ru.expr)
+	if err != nil {
+		return nil, err
+	}
+	if v, err = g.deref(v); err != nil {
+		return nil, err
+	}
+	if v.typ.kind != genBool {
+		return nil, fmt.Errorf("%w: rule result must be bool", ErrTypeMismatch)
+	}
+	for _, name := range lets {
+		if !g.used[name] {
+			g.line("_ = %s", name)
+		}
+	}
+	g.line("return %s, nil", v.expr)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by rulegen. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	fmt.Fprintf(&out, "import gorules %q\n\n", opts.Import)
+	fmt.Fprintf(&out, "// %s %s\n", opts.Func, strings.Join(strings.Fields(opts.Rule), " "))
+	fmt.Fprintf(&out, "func %s(x *%s) (bool, error) {\n", opts.Func, opts.Type)
+	out.WriteString("if x == nil {\nreturn false, gorules.ErrNilPointer\n}\n")
+	out.Write(g.body.Bytes())
+	out.WriteString("}\n")
+	return format.Source(out.Bytes())
+}
+
+// parseTypes 解析目录下所有非测试源码中的类型定义
+func parseTypes(dir string) (string, map[string]ast.Expr, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", nil, err
+	}
+	fset := token.NewFileSet()
+	pkg := ""
+	types := map[string]ast.Expr{}
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return "", nil, err
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.SkipObjectResolution)
+		if err != nil {
+			return "", nil, err
+		}
+		pkg = f.Name.Name
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range gd.Specs {
+				if ts := s.(*ast.TypeSpec); ts.TypeParams == nil {
+					types[ts.Name.Name] = ts.Type
+				}
+			}
+		}
+	}
+	if pkg == "" {
+		return "", nil, fmt.Errorf("no go files in %s", dir)
+	}
+	return pkg, types, nil
+}
+
+// genKind 生成代码时值的种类
+type genKind int
+
+const (
+	genNumber genKind = iota
+	genBool
+	genString
+	genStruct
+	genSlice
+	genMap
+)
+
+// genType 源码中的类型，name是Go类型名，ptr表示值是指向该类型的指针
+type genType struct {
+	kind   genKind
+	name   string
+	fields *ast.StructType
+	elem   *genType
+	ptr    bool
+}
+
+// genValue 生成代码中的一个值，expr是Go表达式
+type genValue struct {
+	expr string
+	typ  genType
+}
+
+var genBasic = map[string]genKind{
+	"int": genNumber, "int8": genNumber, "int16": genNumber, "int32": genNumber, "int64": genNumber,
+	"uint": genNumber, "uint8": genNumber, "uint16": genNumber, "uint32": genNumber, "uint64": genNumber,
+	"float32": genNumber, "float64": genNumber, "byte": genNumber, "rune": genNumber,
+	"string": genString, "bool": genBool,
+}
+
+type generator struct {
+	types map[string]ast.Expr
+	input genValue
+	lets  map[string]genValue
+	used  map[string]bool
+	body  bytes.Buffer
+	n     int
+}
+
+func (g *generator) tmp() string {
+	g.n++
+	return "v" + strconv.Itoa(g.n)
+}
+
+func (g *generator) line(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format+"\n", args...)
+}
+
+// fail 生成返回错误的代码
+func (g *generator) fail(cond, err string) {
+	g.line("if %s {\nreturn false, gorules.%s\n}", cond, err)
+}
+
+func (g *generator) resolve(e ast.Expr) (genType, error) {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if kind, ok := genBasic[t.Name]; ok {
+			return genType{kind: kind, name: t.Name}, nil
+		}
+		def, ok := g.types[t.Name]
+		if !ok {
+			return genType{}, fmt.Errorf("unsupported type %s", t.Name)
+		}
+		gt, err := g.resolve(def)
+		if err != nil {
+			return genType{}, err
+		}
+		if gt.ptr {
+			return genType{}, fmt.Errorf("unsupported pointer type %s", t.Name)
+		}
+		gt.name = t.Name
+		return gt, nil
+	case *ast.StarExpr:
+		gt, err := g.resolve(t.X)
+		if err != nil {
+			return genType{}, err
+		}
+		if gt.ptr {
+			return genType{}, fmt.Errorf("unsupported type %s", exprString(t))
+		}
+		gt.ptr = true
+		return gt, nil
+	case *ast.ArrayType:
+		elem, err := g.resolve(t.Elt)
+		if err != nil {
+			return genType{}, err
+		}
+		return genType{kind: genSlice, name: exprString(t), elem: &elem}, nil
+	case *ast.MapType:
+		key, err := g.resolve(t.Key)
+		if err != nil || key.kind != genString || key.ptr {
+			return genType{}, fmt.Errorf("unsupported map type %s", exprString(t))
+		}
+		elem, err := g.resolve(t.Value)
+		if err != nil {
+			return genType{}, err
+		}
+		return genType{kind: genMap, name: exprString(t), elem: &elem}, nil
+	case *ast.StructType:
+		return genType{kind: genStruct, name: exprString(t), fields: t}, nil
+	default:
+		return genType{}, fmt.Errorf("unsupported type %s", exprString(e))
+	}
+}
+
+// deref 指针取值前检查nil
+func (g *generator) deref(v genValue) (genValue, error) {
+	if !v.typ.ptr {
+		return v, nil
+	}
+	g.fail(v.expr+" == nil", "ErrNilPointer")
+	v.typ.ptr = false
+	if v.typ.kind != genStruct {
+		v.expr = "(*" + v.expr + ")"
+	}
+	return v, nil
+}
+
+func (g *generator) gen(expr ast.Expr) (genValue, error) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if strings.HasPrefix(t.Name, paramPrefix) {
+			return genValue{}, fmt.Errorf("param $%s is not supported", t.Name[len(paramPrefix):])
+		}
+		if v, ok := g.lets[t.Name]; ok {
+			if g.used == nil {
+				g.used = map[string]bool{}
+			}
+			g.used[v.expr] = true
+			return v, nil
+		}
+		if t.Name == "true" || t.Name == "false" {
+			return genValue{expr: t.Name, typ: genType{kind: genBool, name: "bool"}}, nil
+		}
+		return g.field(g.input, t.Name)
+	case *ast.BasicLit:
+		v, err := parseLit(t)
+		if err != nil {
+			return genValue{}, err
+		}
+		switch v := v.(type) {
+		case string:
+			return genValue{expr: strconv.Quote(v), typ: genType{kind: genString, name: "string"}}, nil
+		default:
+			return genValue{expr: t.Value, typ: genType{kind: genNumber, name: untyped}}, nil
+		}
+	case *ast.ParenExpr:
+		return g.gen(t.X)
+	case *ast.SelectorExpr:
+		x, err := g.gen(t.X)
+		if err != nil {
+			return genValue{}, err
+		}
+		return g.field(x, t.Sel.Name)
+	case *ast.IndexExpr:
+		return g.genIndex(t)
+	case *ast.BinaryExpr:
+		return g.genBinary(t)
+	case *ast.CallExpr:
+		return g.genCall(t)
+	default:
+		return genValue{}, ErrUnsupportExpr
+	}
+}
+
+// field 按tag名选择字段，匿名字段的字段提升到外层，与运行时的查找规则一致
+func (g *generator) field(x genValue, name string) (genValue, error) {
+	x, err := g.deref(x)
+	if err != nil {
+		return genValue{}, err
+	}
+	switch x.typ.kind {
+	case genMap:
+		v := g.tmp()
+		g.line("%s, ok := %s[%q]", v, x.expr, name)
+		g.fail("!ok", "ErrNotFoundTag")
+		return genValue{expr: v, typ: *x.typ.elem}, nil
+	case genStruct:
+		steps, ok, err := g.findField(x.typ, name, map[*ast.StructType]bool{})
+		if err != nil {
+			return genValue{}, err
+		}
+		if !ok {
+			return genValue{}, fmt.Errorf("%w: %s in %s", ErrNotFoundTag, name, x.typ.name)
+		}
+		for _, st := range steps[:len(steps)-1] {
+			if x, err = g.deref(genValue{expr: x.expr + "." + st.goName, typ: st.typ}); err != nil {
+				return genValue{}, err
+			}
+		}
+		last := steps[len(steps)-1]
+		return genValue{expr: x.expr + "." + last.goName, typ: last.typ}, nil
+	default:
+		return genValue{}, fmt.Errorf("%w: %s.%s", ErrTypeNotStruct, x.typ.name, name)
+	}
+}
+
+// fieldStep 字段路径中的一步，匿名字段时goName是类型名
+type fieldStep struct {
+	goName string
+	typ    genType
+}
+
+func (g *generator) findField(st genType, name string, visiting map[*ast.StructType]bool) ([]fieldStep, bool, error) {
+	if visiting[st.fields] {
+		return nil, false, nil
+	}
+	visiting[st.fields] = true
+	defer delete(visiting, st.fields)
+
+	var embedded []*ast.Field
+	for _, f := range st.fields.Fields.List {
+		tag := ""
+		if f.Tag != nil {
+			tag, _ = strconv.Unquote(f.Tag.Value)
+		}
+		tagName := getTagName(reflect.StructTag(tag))
+		if len(f.Names) == 0 && tagName == "" {
+			embedded = append(embedded, f)
+			continue
+		}
+		if tagName != name {
+			continue
+		}
+		goName := embeddedName(f)
+		if len(f.Names) > 0 {
+			goName = f.Names[0].Name
+		}
+		if !ast.IsExported(goName) {
+			continue
+		}
+		typ, err := g.resolve(f.Type)
+		if err != nil {
+			return nil, false, err
+		}
+		return []fieldStep{{goName, typ}}, true, nil
+	}
+	for _, f := range embedded {
+		typ, err := g.resolve(f.Type)
+		if err != nil || typ.kind != genStruct {
+			continue
+		}
+		steps, ok, err := g.findField(typ, name, visiting)
+		if err != nil || ok {
+			return append([]fieldStep{{embeddedName(f), typ}}, steps...), ok, err
+		}
+	}
+	return nil, false, nil
+}
+
+func embeddedName(f *ast.Field) string {
+	t := f.Type
+	if s, ok := t.(*ast.StarExpr); ok {
+		t = s.X
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// untyped 数值字面量作为无类型常量参与计算
+const untyped = "untyped"
+
+// num 数值统一按float64计算
+func num(v genValue) string {
+	return conv("float64", v)
+}
+
+// conv 类型不同时才生成类型转换
+func conv(typ string, v genValue) string {
+	if v.typ.name == typ || v.typ.name == untyped {
+		return v.expr
+	}
+	return typ + "(" + v.expr + ")"
+}
+
+func (g *generator) operand(expr ast.Expr) (genValue, error) {
+	v, err := g.gen(expr)
+	if err != nil {
+		return genValue{}, err
+	}
+	return g.deref(v)
+}
+
+func (g *generator) genIndex(t *ast.IndexExpr) (genValue, error) {
+	idx, err := g.operand(t.Index)
+	if err != nil {
+		return genValue{}, err
+	}
+	if idx.typ.kind != genNumber {
+		return genValue{}, fmt.Errorf("%w: index must be number", ErrTypeMismatch)
+	}
+	x, err := g.operand(t.X)
+	if err != nil {
+		return genValue{}, err
+	}
+	if x.typ.kind != genSlice {
+		return genValue{}, fmt.Errorf("%w: only slice or array can get value by index", ErrTypeMismatch)
+	}
+	i := g.tmp()
+	if idx.typ.name == untyped {
+		// 与运行时一样截断小数下标，int(1.5)这样的常量转换无法编译
+		f, err := strconv.ParseFloat(idx.expr, 64)
+		if err != nil {
+			return genValue{}, fmt.Errorf("%w: index %s", ErrTypeMismatch, idx.expr)
+		}
+		g.line("%s := int(%d)", i, int64(f))
+	} else {
+		g.line("%s := int(%s)", i, num(idx))
+	}
+	g.fail(fmt.Sprintf("%s < 0 || %s >= len(%s)", i, i, x.expr), "ErrIndexOutOfRange")
+	return genValue{expr: x.expr + "[" + i + "]", typ: *x.typ.elem}, nil
+}
+
+func (g *generator) genBinary(t *ast.BinaryExpr) (genValue, error) {
+	if t.Op == token.LAND || t.Op == token.LOR {
+		return g.genLogic(t)
+	}
+	x, err := g.operand(t.X)
+	if err != nil {
+		return genValue{}, err
+	}
+	y, err := g.operand(t.Y)
+	if err != nil {
+		return genValue{}, err
+	}
+	v := g.tmp()
+	mismatch := fmt.Errorf("%w: %s %s %s", ErrTypeMismatch, x.typ.name, t.Op, y.typ.name)
+	switch {
+	case mathFuncs[t.Op] != nil:
+		if x.typ.kind != genNumber || y.typ.kind != genNumber {
+			return genValue{}, mismatch
+		}
+		// 两侧都是字面量时按float64计算，避免无类型常量做整数除法
+		left := num(x)
+		if x.typ.name == untyped && y.typ.name == untyped {
+			left = "float64(" + x.expr + ")"
+		}
+		if t.Op == token.QUO {
+			d := g.tmp()
+			g.line("%s := float64(%s)", d, y.expr)
+			g.fail(d+" == 0", "ErrDivZero")
+			g.line("%s := %s / %s", v, left, d)
+		} else {
+			g.line("%s := %s %s %s", v, left, t.Op, num(y))
+		}
+		return genValue{expr: v, typ: genType{kind: genNumber, name: "float64"}}, nil
+	case compareFuncs[t.Op] != nil:
+		switch {
+		case x.typ.kind == genString && y.typ.kind == genString:
+			if t.Op != token.EQL && t.Op != token.NEQ {
+				return genValue{}, mismatch
+			}
+			g.line("%s := %s %s %s", v, conv("string", x), t.Op, conv("string", y))
+		case x.typ.kind == genNumber && y.typ.kind == genNumber:
+			g.line("%s := %s %s %s", v, num(x), t.Op, num(y))
+		default:
+			return genValue{}, mismatch
+		}
+		return genValue{expr: v, typ: genType{kind: genBool, name: "bool"}}, nil
+	default:
+		return genValue{}, ErrUnsupportToken
+	}
+}
+
+// genLogic && ||与运行时一样两侧都先求值
+func (g *generator) genLogic(t *ast.BinaryExpr) (genValue, error) {
+	x, err := g.operand(t.X)
+	if err != nil {
+		return genValue{}, err
+	}
+	if x.typ.kind != genBool {
+		return genValue{}, fmt.Errorf("%w: %s", ErrNotBool, exprString(t.X))
+	}
+	y, err := g.operand(t.Y)
+	if err != nil {
+		return genValue{}, err
+	}
+	if y.typ.kind != genBool {
+		return genValue{}, fmt.Errorf("%w: %s", ErrNotBool, exprString(t.Y))
+	}
+	v := g.tmp()
+	g.line("%s := %s %s %s", v, conv("bool", x), t.Op, conv("bool", y))
+	return genValue{expr: v, typ: genType{kind: genBool, name: "bool"}}, nil
+}
+
+func (g *generator) genCall(t *ast.CallExpr) (genValue, error) {
+	fexp, ok := t.Fun.(*ast.Ident)
+	if !ok || strings.ToUpper(fexp.Name) != "IN" || len(t.Args) != 2 {
+		return genValue{}, fmt.Errorf("unsupport function: %s", exprString(t.Fun))
+	}
+	s, err := g.operand(t.Args[0])
+	if err != nil {
+		return genValue{}, err
+	}
+	k, err := g.operand(t.Args[1])
+	if err != nil {
+		return genValue{}, err
+	}
+	if s.typ.kind != genSlice || s.typ.elem.ptr {
+		return genValue{}, ErrInNotSlice
+	}
+	v := g.tmp()
+	g.line("%s := false", v)
+	switch {
+	case s.typ.elem.kind == genString && k.typ.kind == genString:
+		e := genValue{expr: "e", typ: *s.typ.elem}
+		g.line("for _, e := range %s {\nif %s == %s {\n%s = true\nbreak\n}\n}", s.expr, conv("string", e), conv("string", k), v)
+	case s.typ.elem.kind == genNumber && k.typ.kind == genNumber:
+		e := genValue{expr: "e", typ: *s.typ.elem}
+		g.line("for _, e := range %s {\nif %s == %s {\n%s = true\nbreak\n}\n}", s.expr, num(e), num(k), v)
+	case s.typ.elem.kind == genString || s.typ.elem.kind == genNumber:
+		return genValue{}, fmt.Errorf("%w: in(%s, %s)", ErrTypeMismatch, s.typ.name, k.typ.name)
+	default:
+		return genValue{}, ErrInElemType
+	}
+	return genValue{expr: v, typ: genType{kind: genBool, name: "bool"}}, nil
+}
@@ -0,0 +1,67 @@
+package gorules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join("internal", "gentest")
+	golden := []struct {
+		file string
+		opts GenerateOptions
+	}{
+		{
+			file: "big_order_rule.go",
+			opts: GenerateOptions{Type: "Order", Func: "BigOrder", Rule: `amount * count > 1000 && in(tags, "vip") || user.level == "gold"`},
+		},
+		{
+			file: "discount_order_rule.go",
+			opts: GenerateOptions{Type: "Order", Func: "DiscountOrder", Rule: `let avg = amount / count; avg > user.limit && items[0].price < avg && ext.channel != "test"`},
+		},
+		{
+			file: "second_item_rule.go",
+			opts: GenerateOptions{Type: "Order", Func: "SecondItem", Rule: `items[1.5].price > 50`},
+		},
+	}
+	for _, tt := range golden {
+		t.Run(tt.file, func(t *testing.T) {
+			tt.opts.Dir = dir
+			got, err := Generate(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(filepath.Join(dir, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Generate() = \n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+
+	got, err := Generate(GenerateOptions{Dir: dir, Type: "Order", Func: "F", Rule: "amount > 1", Import: "example.com/rules"})
+	if err != nil || !strings.Contains(string(got), `import gorules "example.com/rules"`) {
+		t.Errorf("Generate() with Import = %s, %v", got, err)
+	}
+
+	failures := []GenerateOptions{
+		{Type: "Missing", Func: "F", Rule: "amount > 1"},
+		{Type: "Level", Func: "F", Rule: "amount > 1"},
+		{Type: "Order", Func: "F", Rule: "amount > $min"},
+		{Type: "Order", Func: "F", Rule: "amout > 1"},
+		{Type: "Order", Func: "F", Rule: "amount + 1"},
+		{Type: "Order", Func: "F", Rule: `amount > "1"`},
+		{Type: "Order", Func: "F", Rule: "in(tags, amount)"},
+		{Type: "Order", Func: "F", Rule: "user.level < \"a\""},
+	}
+	for _, opts := range failures {
+		opts.Dir = dir
+		if _, err := Generate(opts); err == nil {
+			t.Errorf("Generate(%s, %q) want error", opts.Type, opts.Rule)
+		}
+	}
+}
@@ -1,3 +1,8 @@
 module go-rules
 
-go 1.14
+go 1.18
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.19
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,244 @@
+package gorules
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// defaultMaxCycles NewEngine默认最多触发规则的次数
+const defaultMaxCycles = 1000
+
+// WorkingMemory 推理的工作内存，规则中的标识符按名字读取事实，
+// 事实的值发生变化时版本号加一
+type WorkingMemory struct {
+	facts   map[string]interface{}
+	version int
+}
+
+// NewWorkingMemory 用facts的副本创建工作内存
+func NewWorkingMemory(facts map[string]interface{}) *WorkingMemory {
+	m := &WorkingMemory{facts: make(map[string]interface{}, len(facts))}
+	for k, v := range facts {
+		m.facts[k] = v
+	}
+	return m
+}
+
+// Get 读取事实
+func (m *WorkingMemory) Get(name string) (interface{}, bool) {
+	v, ok := m.facts[name]
+	return v, ok
+}
+
+// Assert 新增或修改事实，值没有变化时不算修改
+func (m *WorkingMemory) Assert(name string, v interface{}) {
+	if old, ok := m.facts[name]; ok && sameFact(old, v) {
+		return
+	}
+	m.facts[name] = v
+	m.version++
+}
+
+// sameFact 数值按值比较，int(1)与float64(1)相同，其他用reflect.DeepEqual
+func sameFact(x, y interface{}) bool {
+	nx, errx := number(reflect.ValueOf(x))
+	ny, erry := number(reflect.ValueOf(y))
+	if errx == nil && erry == nil {
+		return nx == ny
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// Retract 删除事实
+func (m *WorkingMemory) Retract(name string) {
+	if _, ok := m.facts[name]; ok {
+		delete(m.facts, name)
+		m.version++
+	}
+}
+
+// Facts 所有事实的副本
+func (m *WorkingMemory) Facts() map[string]interface{} {
+	facts := make(map[string]interface{}, len(m.facts))
+	for k, v := range m.facts {
+		facts[k] = v
+	}
+	return facts
+}
+
+// Engine 前向推理引擎：规则的条件读取工作内存中的事实，Then把结果写回工作内存，
+// Action回调收到的x是*WorkingMemory，可以直接Assert、Retract。
+//
+// 每一轮把条件成立的规则放入议程，按优先级（salience）从高到低、相同优先级按加入顺序选出一条触发，
+// 直到议程为空。规则触发后，条件读取的事实都没有变化时不会再次触发；
+// 条件引用的第一级事实还不存在时规则不激活，事实存在但字段路径错误时返回错误。
+// 不在有效期内的规则不参与推理
+type Engine struct {
+	rules *RuleSet
+	// MaxCycles 最多触发规则的次数，超过时返回ErrCycleLimit，0表示不限制
+	MaxCycles int
+}
+
+// NewEngine 在规则集上创建推理引擎，MaxCycles默认为1000
+func NewEngine(rules *RuleSet) *Engine {
+	return &Engine{rules: rules, MaxCycles: defaultMaxCycles}
+}
+
+// Inference 推理的结果，Fired是按触发顺序排列的规则ID
+type Inference struct {
+	Memory *WorkingMemory
+	Fired  []string
+}
+
+// Run 从facts开始推理直到没有规则可以触发，vars是规则中的外部参数
+func (e *Engine) Run(facts map[string]interface{}, vars Vars) (*Inference, error) {
+	return e.RunAt(facts, vars, time.Time{})
+}
+
+// RunAt 与Run相同，按时间at判断规则的有效期，at为零值时使用当前时间
+func (e *Engine) RunAt(facts map[string]interface{}, vars Vars, at time.Time) (*Inference, error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	inf := &Inference{Memory: NewWorkingMemory(facts)}
+	m := inf.Memory
+	env := Env{Input: m.facts, Vars: vars}
+	var rules []*activation
+	for _, r := range e.rules.ordered(at) {
+		rules = append(rules, &activation{rule: r, facts: factNames(r.Rule)})
+	}
+	for {
+		next, err := agenda(rules, env, m)
+		if err != nil || next == nil {
+			return inf, err
+		}
+		if e.MaxCycles > 0 && len(inf.Fired) >= e.MaxCycles {
+			return inf, fmt.Errorf("%w: %d", ErrCycleLimit, e.MaxCycles)
+		}
+		next.fire(m)
+		res, err := evalOutcome(env, next.rule)
+		if err != nil {
+			return inf, err
+		}
+		for k, v := range res.Values {
+			m.Assert(k, v)
+		}
+		if err := e.rules.runAction(m, res); err != nil {
+			return inf, err
+		}
+		next.version = m.version
+		inf.Fired = append(inf.Fired, next.rule.ID)
+	}
+}
+
+// agenda 返回议程中优先级最高的规则，议程为空时返回nil
+func agenda(rules []*activation, env Env, m *WorkingMemory) (*activation, error) {
+	for _, a := range rules {
+		if a.refracted(m) || !a.ready(m) {
+			continue
+		}
+		ok, err := a.rule.Rule.Bool(env)
+		// 无法分析读取哪些事实的规则，找不到事实时同样不激活
+		if a.facts == nil && errors.Is(err, ErrNotFoundTag) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", a.rule.ID, err)
+		}
+		if ok {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+// activation 规则最近一次触发时读取的事实的值，facts为nil时无法分析规则读取的事实，
+// 改为比较工作内存触发后的版本号
+type activation struct {
+	rule    *NamedRule
+	facts   []string
+	fired   bool
+	values  []interface{}
+	version int
+}
+
+func (a *activation) fire(m *WorkingMemory) {
+	a.fired = true
+	a.values = a.values[:0]
+	for _, name := range a.facts {
+		a.values = append(a.values, m.facts[name])
+	}
+}
+
+// ready 条件读取的第一级事实都已存在
+func (a *activation) ready(m *WorkingMemory) bool {
+	for _, name := range a.facts {
+		if _, ok := m.facts[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// refracted 规则已经触发过，并且读取的事实都没有变化
+func (a *activation) refracted(m *WorkingMemory) bool {
+	if !a.fired {
+		return false
+	}
+	if a.facts == nil {
+		return a.version == m.version
+	}
+	for i, name := range a.facts {
+		if !sameFact(m.facts[name], a.values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// factNames 规则读取的事实名，即不是let变量和外部参数的第一级标识符
+func factNames(r Rule) []string {
+	ru, ok := r.(*rule)
+	if !ok {
+		return nil
+	}
+	names := []string{}
+	seen := map[string]bool{}
+	sc := scope{}
+	var walk func(ast.Expr)
+	walk = func(expr ast.Expr) {
+		switch t := expr.(type) {
+		case *ast.Ident:
+			if _, ok := sc[t.Name]; ok || seen[t.Name] || t.Name == "true" || t.Name == "false" ||
+				strings.HasPrefix(t.Name, paramPrefix) {
+				return
+			}
+			seen[t.Name] = true
+			names = append(names, t.Name)
+		case *ast.SelectorExpr:
+			walk(t.X)
+		case *ast.CallExpr:
+			for _, a := range t.Args {
+				walk(a)
+			}
+		case *ast.ParenExpr:
+			walk(t.X)
+		case *ast.BinaryExpr:
+			walk(t.X)
+			walk(t.Y)
+		case *ast.IndexExpr:
+			walk(t.X)
+			walk(t.Index)
+		}
+	}
+	for i, l := range ru.lets {
+		walk(l.expr)
+		sc[l.name] = i
+	}
+	walk(ru.expr)
+	return names
+}
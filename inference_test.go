@@ -0,0 +1,115 @@
+package gorules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestEngine(t *testing.T, defs ...RuleDef) *Engine {
+	s := NewRuleSet()
+	for _, d := range defs {
+		r, err := d.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewEngine(s)
+}
+
+func TestEngine_Run(t *testing.T) {
+	e := newTestEngine(t,
+		RuleDef{ID: "review", When: `flag == "high" && amount > 1000`, Then: map[string]string{"require_review": "true"}},
+		RuleDef{ID: "risk", When: "risk > 80", Then: map[string]string{"flag": `"high"`}},
+		RuleDef{ID: "limit", When: "risk > $limit", Priority: 10, Then: map[string]string{"limit_hit": "risk - $limit"}},
+		RuleDef{ID: "clear", When: "require_review", Action: "clear"},
+	)
+	e.rules.SetAction("clear", func(x interface{}, res *Result) error {
+		x.(*WorkingMemory).Retract("flag")
+		return nil
+	})
+	inf, err := e.Run(map[string]interface{}{"risk": 90, "amount": 5000}, Vars{"limit": 85})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"limit", "risk", "review", "clear"}; !reflect.DeepEqual(inf.Fired, want) {
+		t.Errorf("Fired = %v, want %v", inf.Fired, want)
+	}
+	want := map[string]interface{}{"risk": 90, "amount": 5000, "limit_hit": float64(5), "require_review": true}
+	if got := inf.Memory.Facts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Facts() = %v, want %v", got, want)
+	}
+
+	inf, err = e.Run(map[string]interface{}{"risk": 10, "amount": 5000}, Vars{"limit": 85})
+	if err != nil || len(inf.Fired) != 0 {
+		t.Errorf("Run() fired = %v, %v, want none", inf.Fired, err)
+	}
+}
+
+func TestEngine_limit(t *testing.T) {
+	// 条件读取的事实变化后规则再次触发
+	e := newTestEngine(t, RuleDef{ID: "inc", When: "n < 3", Then: map[string]string{"n": "n + 1"}})
+	inf, err := e.Run(map[string]interface{}{"n": 0}, nil)
+	if err != nil || !reflect.DeepEqual(inf.Fired, []string{"inc", "inc", "inc"}) {
+		t.Errorf("Run() fired = %v, %v, want inc 3 times", inf.Fired, err)
+	}
+
+	// 事实没有变化时不再触发
+	e = newTestEngine(t,
+		RuleDef{ID: "a", When: "x == 1", Then: map[string]string{"x": "2"}},
+		RuleDef{ID: "b", When: "x == 2", Then: map[string]string{"x": "1"}},
+	)
+	if inf, err = e.Run(map[string]interface{}{"x": 1}, nil); err != nil || !reflect.DeepEqual(inf.Fired, []string{"a", "b"}) {
+		t.Errorf("Run() fired = %v, %v, want [a b]", inf.Fired, err)
+	}
+
+	e = newTestEngine(t, RuleDef{ID: "forever", When: "n >= 0", Then: map[string]string{"n": "n + 1"}})
+	e.MaxCycles = 10
+	inf, err = e.Run(map[string]interface{}{"n": 0}, nil)
+	if !errors.Is(err, ErrCycleLimit) || len(inf.Fired) != 10 {
+		t.Errorf("Run() fired %d, error = %v, want ErrCycleLimit", len(inf.Fired), err)
+	}
+
+	e = newTestEngine(t, RuleDef{ID: "bad", When: "x > 1", Then: map[string]string{"y": "x / 0"}})
+	if _, err := e.Run(map[string]interface{}{"x": 2}, nil); !errors.Is(err, ErrDivZero) {
+		t.Errorf("Run() error = %v, want ErrDivZero", err)
+	}
+}
+
+func TestEngine_missingFact(t *testing.T) {
+	// 第一级事实不存在时规则不激活，字段路径错误时返回错误
+	e := newTestEngine(t, RuleDef{ID: "city", When: `user.ctiy == "bj"`, Then: map[string]string{"local": "true"}})
+	inf, err := e.Run(map[string]interface{}{"amount": 1}, nil)
+	if err != nil || len(inf.Fired) != 0 {
+		t.Errorf("Run() fired = %v, %v, want none", inf.Fired, err)
+	}
+	_, err = e.Run(map[string]interface{}{"user": map[string]interface{}{"city": "bj"}}, nil)
+	if !errors.Is(err, ErrNotFoundTag) {
+		t.Errorf("Run() error = %v, want ErrNotFoundTag", err)
+	}
+}
+
+func TestEngine_RunAt(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := newTestEngine(t, RuleDef{ID: "promo", When: "amount > 100", Then: map[string]string{"promo": "true"}, EffectiveFrom: &from, EffectiveTo: &to})
+	facts := map[string]interface{}{"amount": 200}
+	tests := []struct {
+		at   time.Time
+		want int
+	}{
+		{at: from.Add(-time.Hour), want: 0},
+		{at: from, want: 1},
+		{at: to, want: 0},
+	}
+	for _, tt := range tests {
+		inf, err := e.RunAt(facts, nil, tt.at)
+		if err != nil || len(inf.Fired) != tt.want {
+			t.Errorf("RunAt(%v) fired = %v, %v, want %d", tt.at, inf.Fired, err, tt.want)
+		}
+	}
+}
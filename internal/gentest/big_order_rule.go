@@ -0,0 +1,28 @@
+// Code generated by rulegen. DO NOT EDIT.
+
+package gentest
+
+import gorules "go-rules"
+
+// BigOrder amount * count > 1000 && in(tags, "vip") || user.level == "gold"
+func BigOrder(x *Order) (bool, error) {
+	if x == nil {
+		return false, gorules.ErrNilPointer
+	}
+	v1 := x.Amount * float64(x.Count)
+	v2 := v1 > 1000
+	v3 := false
+	for _, e := range x.Tags {
+		if e == "vip" {
+			v3 = true
+			break
+		}
+	}
+	v4 := v2 && v3
+	if x.User == nil {
+		return false, gorules.ErrNilPointer
+	}
+	v5 := string(x.User.Level) == "gold"
+	v6 := v4 || v5
+	return v6, nil
+}
@@ -0,0 +1,35 @@
+// Code generated by rulegen. DO NOT EDIT.
+
+package gentest
+
+import gorules "go-rules"
+
+// DiscountOrder let avg = amount / count; avg > user.limit && items[0].price < avg && ext.channel != "test"
+func DiscountOrder(x *Order) (bool, error) {
+	if x == nil {
+		return false, gorules.ErrNilPointer
+	}
+	v2 := float64(x.Count)
+	if v2 == 0 {
+		return false, gorules.ErrDivZero
+	}
+	v1 := x.Amount / v2
+	v3 := v1 // let avg
+	if x.User == nil {
+		return false, gorules.ErrNilPointer
+	}
+	v4 := v3 > x.User.Limit
+	v5 := int(0)
+	if v5 < 0 || v5 >= len(x.Items) {
+		return false, gorules.ErrIndexOutOfRange
+	}
+	v6 := float64(x.Items[v5].Price) < v3
+	v7 := v4 && v6
+	v8, ok := x.Ext["channel"]
+	if !ok {
+		return false, gorules.ErrNotFoundTag
+	}
+	v9 := v8 != "test"
+	v10 := v7 && v9
+	return v10, nil
+}
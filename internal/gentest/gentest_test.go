@@ -0,0 +1,47 @@
+package gentest
+
+import (
+	"errors"
+	"testing"
+
+	gorules "go-rules"
+)
+
+func TestGenerated(t *testing.T) {
+	funcs := []struct {
+		rule string
+		fn   func(*Order) (bool, error)
+	}{
+		{rule: `amount * count > 1000 && in(tags, "vip") || user.level == "gold"`, fn: BigOrder},
+		{rule: `let avg = amount / count; avg > user.limit && items[0].price < avg && ext.channel != "test"`, fn: DiscountOrder},
+		{rule: `items[1.5].price > 50`, fn: SecondItem},
+	}
+	orders := []*Order{
+		{Amount: 600, Count: 2, Tags: []string{"vip"}},
+		{Amount: 600, Count: 2, Tags: []string{"new"}, User: &User{Level: "gold"}},
+		{Amount: 600, Count: 2, Tags: []string{"new"}, User: &User{Level: "silver", Limit: 100}, Items: []Item{{Price: 99}}, Ext: map[string]string{"channel": "app"}},
+		{Amount: 600, Count: 2, User: &User{Limit: 100}, Items: []Item{{Price: 99}}, Ext: map[string]string{"channel": "test"}},
+		{Amount: 600, Count: 2, User: &User{Limit: 100}, Items: []Item{{Price: 99}}},
+		{Amount: 600, Count: 2, Items: []Item{{Price: 10}, {Price: 60}}},
+		{Amount: 600, Count: 2, User: &User{Limit: 100}},
+		{Amount: 600, Count: 0, User: &User{}},
+		{Amount: 10, Count: 1},
+		{Base: Base{ID: 1}, Amount: 10, Count: 1, User: &User{Limit: 100}},
+	}
+	for _, f := range funcs {
+		r, err := gorules.NewRule(f.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, o := range orders {
+			want, wantErr := r.Bool(o)
+			got, err := f.fn(o)
+			if got != want || (err == nil) != (wantErr == nil) || (err != nil && !errors.Is(err, wantErr)) {
+				t.Errorf("%s order %d = %v, %v, want %v, %v", f.rule, i, got, err, want, wantErr)
+			}
+		}
+	}
+	if _, err := BigOrder(nil); !errors.Is(err, gorules.ErrNilPointer) {
+		t.Errorf("BigOrder(nil) error = %v", err)
+	}
+}
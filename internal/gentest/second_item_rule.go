@@ -0,0 +1,18 @@
+// Code generated by rulegen. DO NOT EDIT.
+
+package gentest
+
+import gorules "go-rules"
+
+// SecondItem items[1.5].price > 50
+func SecondItem(x *Order) (bool, error) {
+	if x == nil {
+		return false, gorules.ErrNilPointer
+	}
+	v1 := int(1)
+	if v1 < 0 || v1 >= len(x.Items) {
+		return false, gorules.ErrIndexOutOfRange
+	}
+	v2 := float64(x.Items[v1].Price) > 50
+	return v2, nil
+}
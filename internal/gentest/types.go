@@ -0,0 +1,36 @@
+// Package gentest 用于验证rulegen生成的代码与Rule.Bool的结果一致
+package gentest
+
+//go:generate go run go-rules/cmd/rulegen -type Order -func BigOrder -rule "amount * count > 1000 && in(tags, \"vip\") || user.level == \"gold\"" -o big_order_rule.go
+//go:generate go run go-rules/cmd/rulegen -type Order -func DiscountOrder -rule "let avg = amount / count; avg > user.limit && items[0].price < avg && ext.channel != \"test\"" -o discount_order_rule.go
+//go:generate go run go-rules/cmd/rulegen -type Order -func SecondItem -rule "items[1.5].price > 50" -o second_item_rule.go
+
+// Level 会员等级
+type Level string
+
+// User 下单用户
+type User struct {
+	Level Level   `json:"level"`
+	Limit float64 `json:"limit"`
+}
+
+// Item 商品
+type Item struct {
+	Price float32 `json:"price"`
+}
+
+// Base 公共字段
+type Base struct {
+	ID int64 `json:"id"`
+}
+
+// Order 订单
+type Order struct {
+	Base
+	Amount float64           `json:"amount"`
+	Count  int               `json:"count"`
+	Tags   []string          `json:"tags"`
+	User   *User             `json:"user"`
+	Items  []Item            `json:"items"`
+	Ext    map[string]string `json:"ext"`
+}
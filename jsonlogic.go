@@ -0,0 +1,288 @@
+package gorules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonLogicOps JSONLogic运算符对应的token，and、or、+、*可以有多个参数，按左结合展开
+var jsonLogicOps = map[string]token.Token{
+	"+": token.ADD, "-": token.SUB, "*": token.MUL, "/": token.QUO,
+	"==": token.EQL, "===": token.EQL, "!=": token.NEQ, "!==": token.NEQ,
+	"<": token.LSS, "<=": token.LEQ, ">": token.GTR, ">=": token.GEQ,
+	"and": token.LAND, "or": token.LOR,
+}
+
+// ParseJSONLogic 把JSONLogic文档编译为规则，运算符使用规则本身的语义：
+// ==、===都按规则的==比较，and、or的参数必须是bool。
+// 支持var、+ - * /、比较运算、and、or、in，其他运算符返回ErrJSONLogic
+func ParseJSONLogic(data []byte) (Rule, error) {
+	e, err := parseJSONLogic(data)
+	if err != nil {
+		return nil, err
+	}
+	return e.Rule()
+}
+
+// ParseJSONLogicFor 编译JSONLogic文档并绑定输入类型，typ与NewRuleFor相同
+func ParseJSONLogicFor(typ interface{}, data []byte) (TypedRule, error) {
+	e, err := parseJSONLogic(data)
+	if err != nil {
+		return nil, err
+	}
+	return e.RuleFor(typ)
+}
+
+func parseJSONLogic(data []byte) (Expr, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return Expr{}, fmt.Errorf("%w: %v", ErrJSONLogic, err)
+	}
+	if err := dec.Decode(new(interface{})); err != io.EOF {
+		return Expr{}, fmt.Errorf("%w: trailing data after the rule", ErrJSONLogic)
+	}
+	e := logicExpr(v)
+	return e, e.err
+}
+
+// logicExpr 把解码后的JSONLogic值转换为表达式
+func logicExpr(v interface{}) Expr {
+	switch t := v.(type) {
+	case bool, string:
+		return Lit(t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return Lit(i)
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return Expr{err: fmt.Errorf("%w: number %s", ErrJSONLogic, t)}
+		}
+		return Lit(f)
+	case map[string]interface{}:
+		if len(t) != 1 {
+			return Expr{err: fmt.Errorf("%w: operation must have exactly one key", ErrJSONLogic)}
+		}
+		for op, arg := range t {
+			args, ok := arg.([]interface{})
+			if !ok {
+				args = []interface{}{arg}
+			}
+			return logicOp(op, args)
+		}
+	}
+	return Expr{err: fmt.Errorf("%w: value %v", ErrJSONLogic, v)}
+}
+
+func logicOp(op string, args []interface{}) Expr {
+	if op == "var" {
+		return logicVar(args)
+	}
+	xs := make([]Expr, len(args))
+	for i, a := range args {
+		xs[i] = logicExpr(a)
+		if xs[i].err != nil {
+			return xs[i]
+		}
+	}
+	n := len(xs)
+	switch {
+	case op == "in" && n == 2:
+		// 规则没有数组字面量，也不支持子串判断
+		switch args[1].(type) {
+		case []interface{}, string:
+			return Expr{err: fmt.Errorf("%w: in needs a var as the second argument", ErrJSONLogic)}
+		}
+		return In(xs[1], xs[0])
+	case op == "-" && n == 1:
+		return Lit(0).Sub(xs[0])
+	case (op == "<" || op == "<=") && n == 3:
+		// between：a < b < c
+		tok := jsonLogicOps[op]
+		return xs[0].binary(tok, xs[1]).And(xs[1].binary(tok, xs[2]))
+	}
+	tok, ok := jsonLogicOps[op]
+	if !ok {
+		return Expr{err: fmt.Errorf("%w: operator %q", ErrJSONLogic, op)}
+	}
+	variadic := tok == token.LAND || tok == token.LOR || tok == token.ADD || tok == token.MUL
+	if n < 2 || n > 2 && !variadic {
+		return Expr{err: fmt.Errorf("%w: %s with %d args", ErrJSONLogic, op, n)}
+	}
+	e := xs[0]
+	for _, y := range xs[1:] {
+		e = e.binary(tok, y)
+	}
+	return e
+}
+
+// logicVar {"var": "a.b.0"}，数字段是下标，不支持默认值
+func logicVar(args []interface{}) Expr {
+	if len(args) != 1 {
+		return Expr{err: fmt.Errorf("%w: var with default value", ErrJSONLogic)}
+	}
+	path, ok := args[0].(string)
+	if !ok || path == "" {
+		return Expr{err: fmt.Errorf("%w: var %v", ErrJSONLogic, args[0])}
+	}
+	parts := strings.Split(path, ".")
+	e := Field(parts[0])
+	for _, p := range parts[1:] {
+		if i, err := strconv.ParseUint(p, 10, 63); err == nil {
+			e = e.Index(Lit(i))
+		} else {
+			e = e.Field(p)
+		}
+	}
+	if e.err != nil {
+		return Expr{err: fmt.Errorf("%w: var %q", ErrJSONLogic, path)}
+	}
+	return e
+}
+
+// ToJSONLogic 把NewRule、NewRuleFor创建的规则导出为JSONLogic，let变量展开为定义的表达式。
+// 外部参数、let变量的字段和下标等JSONLogic无法表示的部分返回ErrJSONLogic
+func ToJSONLogic(r Rule) ([]byte, error) {
+	ru, ok := r.(*rule)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupport rule type %T", ErrJSONLogic, r)
+	}
+	lets := map[string]interface{}{}
+	for _, l := range ru.lets {
+		v, err := toLogic(l.expr, lets)
+		if err != nil {
+			return nil, err
+		}
+		lets[l.name] = v
+	}
+	v, err := toLogic(ru.expr, lets)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// logicNames token对应的JSONLogic运算符
+var logicNames = map[token.Token]string{
+	token.ADD: "+", token.SUB: "-", token.MUL: "*", token.QUO: "/",
+	token.EQL: "==", token.NEQ: "!=", token.LSS: "<", token.LEQ: "<=", token.GTR: ">", token.GEQ: ">=",
+	token.LAND: "and", token.LOR: "or",
+}
+
+func toLogic(expr ast.Expr, lets map[string]interface{}) (interface{}, error) {
+	switch t := expr.(type) {
+	case *ast.ParenExpr:
+		return toLogic(t.X, lets)
+	case *ast.BinaryExpr:
+		op, ok := logicNames[t.Op]
+		if !ok {
+			return nil, fmt.Errorf("%w: operator %s", ErrJSONLogic, t.Op)
+		}
+		// 左结合的and、or、+、*合并为一个多参数运算，导入时按同样的顺序展开
+		var args []interface{}
+		if x, ok := unparen(t.X).(*ast.BinaryExpr); ok && x.Op == t.Op && (op == "and" || op == "or" || op == "+" || op == "*") {
+			v, err := toLogic(x, lets)
+			if err != nil {
+				return nil, err
+			}
+			args = v.(map[string]interface{})[op].([]interface{})
+		} else {
+			v, err := toLogic(t.X, lets)
+			if err != nil {
+				return nil, err
+			}
+			args = []interface{}{v}
+		}
+		y, err := toLogic(t.Y, lets)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{op: append(args, y)}, nil
+	case *ast.Ident:
+		if v, ok := lets[t.Name]; ok {
+			return v, nil
+		}
+		if t.Name == "true" || t.Name == "false" {
+			return t.Name == "true", nil
+		}
+		if strings.HasPrefix(t.Name, paramPrefix) {
+			return nil, fmt.Errorf("%w: param $%s", ErrJSONLogic, t.Name[len(paramPrefix):])
+		}
+		return map[string]interface{}{"var": t.Name}, nil
+	case *ast.BasicLit:
+		v, err := parseLit(t)
+		if err != nil {
+			return nil, err
+		}
+		if f, ok := v.(float64); ok {
+			// 保留小数点，导入时仍是浮点数
+			s := strconv.FormatFloat(f, 'g', -1, 64)
+			if !strings.ContainsAny(s, ".e") {
+				s += ".0"
+			}
+			return json.Number(s), nil
+		}
+		return v, nil
+	case *ast.SelectorExpr, *ast.IndexExpr:
+		path, err := logicPath(t, lets)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"var": path}, nil
+	case *ast.CallExpr:
+		if f, ok := t.Fun.(*ast.Ident); !ok || !strings.EqualFold(f.Name, "in") || len(t.Args) != 2 {
+			return nil, fmt.Errorf("%w: call %s", ErrJSONLogic, exprText(t))
+		}
+		slice, err := toLogic(t.Args[0], lets)
+		if err != nil {
+			return nil, err
+		}
+		key, err := toLogic(t.Args[1], lets)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"in": []interface{}{key, slice}}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrJSONLogic, exprText(expr))
+	}
+}
+
+// logicPath 字段和常量下标组成的路径，如f.z[0]为f.z.0
+func logicPath(expr ast.Expr, lets map[string]interface{}) (string, error) {
+	switch t := unparen(expr).(type) {
+	case *ast.Ident:
+		if _, ok := lets[t.Name]; !ok && !strings.HasPrefix(t.Name, paramPrefix) {
+			return t.Name, nil
+		}
+	case *ast.SelectorExpr:
+		x, err := logicPath(t.X, lets)
+		if err != nil {
+			return "", err
+		}
+		return x + "." + t.Sel.Name, nil
+	case *ast.IndexExpr:
+		lit, ok := unparen(t.Index).(*ast.BasicLit)
+		if ok && lit.Kind == token.INT && !strings.HasPrefix(lit.Value, "-") {
+			x, err := logicPath(t.X, lets)
+			if err != nil {
+				return "", err
+			}
+			return x + "." + lit.Value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: path %s", ErrJSONLogic, exprText(expr))
+}
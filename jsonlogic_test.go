@@ -0,0 +1,110 @@
+package gorules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseJSONLogic(t *testing.T) {
+	tests := []struct {
+		logic string
+		want  string
+	}{
+		{logic: `{">":[{"var":"a"},1]}`, want: `a > 1`},
+		{logic: `{"and":[{"<":[{"var":"a"},10]},{"==":[{"var":"c"},"abc"]},{"!==":[{"var":"b"},2.5]}]}`, want: `a < 10 && c == "abc" && b != 2.5`},
+		{logic: `{"or":[{"===":[{"var":"a"},1]},{"in":["y",{"var":"d"}]}]}`, want: `a == 1 || in(d, "y")`},
+		{logic: `{"<=":[1,{"var":"a"},3]}`, want: `1 <= a && a <= 3`},
+		{logic: `{"+":[{"var":"a"},{"var":"b"},1]}`, want: `a + b + 1`},
+		{logic: `{"*":[{"-":[{"var":"a"},{"var":"b"}]},{"/":[{"var":"e.0"},2]}]}`, want: `(a - b) * (e[0] / 2)`},
+		{logic: `{"-":{"var":"b"}}`, want: `0 - b`},
+		{logic: `{">=":[{"var":"a"},-2]}`, want: `a >= 0 - 2`},
+		{logic: `{"in":["z",{"var":"f.z"}]}`, want: `in(f.z, "z")`},
+		{logic: `true`, want: `true`},
+	}
+	env := Env{Input: evalType{A: 3, B: 1.5, C: "abc", D: []string{"x", "y"}, E: []int64{7}, F: xyz{Z: []string{"z"}}}}
+	for _, tt := range tests {
+		r, err := ParseJSONLogic([]byte(tt.logic))
+		if err != nil {
+			t.Fatalf("ParseJSONLogic(%s) error = %v", tt.logic, err)
+		}
+		if got, _ := Format(r); got != tt.want {
+			t.Errorf("ParseJSONLogic(%s) = %s, want %s", tt.logic, got, tt.want)
+		}
+		want, _ := NewRule(tt.want)
+		v, err := r.Eval(env)
+		wantV, wantErr := want.Eval(env)
+		if !reflect.DeepEqual(v, wantV) || (err == nil) != (wantErr == nil) {
+			t.Errorf("%s: Eval() = %v, %v, want %v, %v", tt.logic, v, err, wantV, wantErr)
+		}
+	}
+	if _, err := ParseJSONLogicFor(evalType{}, []byte(`{"+":[{"var":"c"},1]}`)); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("ParseJSONLogicFor() error = %v, want ErrTypeMismatch", err)
+	}
+}
+
+func TestParseJSONLogic_errors(t *testing.T) {
+	tests := []string{
+		`{"if":[true,1,2]}`,
+		`{"!":[{"var":"a"}]}`,
+		`{"var":["a",0]}`,
+		`{"var":""}`,
+		`{"var":"0.a"}`,
+		`{"in":["x",["x","y"]]}`,
+		`{"in":["b","abc"]}`,
+		`{"/":[1,2,3]}`,
+		`{">":[1]}`,
+		`{">":[1,2],"<":[1,2]}`,
+		`null`,
+		`{"var":"a"} junk`,
+		`{"var":"a"} {"var":"b"}`,
+		`{`,
+	}
+	for _, logic := range tests {
+		if _, err := ParseJSONLogic([]byte(logic)); !errors.Is(err, ErrJSONLogic) {
+			t.Errorf("ParseJSONLogic(%s) error = %v, want ErrJSONLogic", logic, err)
+		}
+	}
+}
+
+func TestToJSONLogic(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{src: `a > 1 && c == "abc" && b != 2.0`, want: `{"and":[{">":[{"var":"a"},1]},{"==":[{"var":"c"},"abc"]},{"!=":[{"var":"b"},2.0]}]}`},
+		{src: `a < 1 || (b > 2 || IN(d, "x"))`, want: `{"or":[{"<":[{"var":"a"},1]},{"or":[{">":[{"var":"b"},2]},{"in":["x",{"var":"d"}]}]}]}`},
+		{src: `f.z[0] == "z" && e[0] - 1 > 0`, want: `{"and":[{"==":[{"var":"f.z.0"},"z"]},{">":[{"-":[{"var":"e.0"},1]},0]}]}`},
+		{src: `let m = a * 2; m + b >= 7.5`, want: `{">=":[{"+":[{"*":[{"var":"a"},2]},{"var":"b"}]},7.5]}`},
+	}
+	for _, tt := range tests {
+		r, err := NewRule(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ToJSONLogic(r)
+		if err != nil {
+			t.Fatalf("ToJSONLogic(%s) error = %v", tt.src, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("ToJSONLogic(%s) = %s\nwant %s", tt.src, got, tt.want)
+		}
+		back, err := ParseJSONLogic(got)
+		if err != nil {
+			t.Fatalf("ParseJSONLogic(%s) error = %v", got, err)
+		}
+		again, _ := ToJSONLogic(back)
+		if string(again) != string(got) {
+			t.Errorf("%s: export again = %s, want %s", tt.src, again, got)
+		}
+	}
+	for _, src := range []string{`a > $min`, `let f2 = f; f2.z[0] == "z"`, `e[a] > 1`} {
+		r, err := NewRule(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ToJSONLogic(r); !errors.Is(err, ErrJSONLogic) {
+			t.Errorf("ToJSONLogic(%s) error = %v, want ErrJSONLogic", src, err)
+		}
+	}
+}
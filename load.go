@@ -0,0 +1,241 @@
+package gorules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleFile 规则文件的格式，YAML和JSON使用相同的字段（JSON按YAML的子集解析），
+// 文件也可以直接是规则的列表：
+//
+//	rules:
+//	  - id: vip                      # 必填，规则集中唯一
+//	    description: vip discount
+//	    tags: [discount]
+//	    priority: 10                 # 数值越大越优先
+//	    disabled: false
+//	    when: level >= 3 && amount > 100
+//	    value: amount * 0.1          # 结果值
+//	    then: {reason: '"vip"'}      # 一组结果，值是表达式
+//	    action: notify               # 注册到RuleSet的回调名
+//	    effective_from: 2024-01-01T00:00:00Z
+//	    effective_to: 2025-01-01T00:00:00Z
+type RuleFile struct {
+	Rules []RuleDef `json:"rules" yaml:"rules"`
+}
+
+// ruleFields 规则定义中允许的字段，其他字段视为拼写错误
+var ruleFields = map[string]bool{
+	"id": true, "version": true, "description": true, "tags": true, "priority": true, "disabled": true, "when": true,
+	"value": true, "then": true, "action": true, "effective_from": true, "effective_to": true,
+}
+
+// LoadError 规则文件中的一个错误，Line、Column从1开始，为0时位置未知
+type LoadError struct {
+	File   string
+	Line   int
+	Column int
+	Rule   string
+	Field  string
+	Err    error
+}
+
+func (e *LoadError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.File)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+	}
+	if e.Column > 0 {
+		fmt.Fprintf(&b, ":%d", e.Column)
+	}
+	b.WriteString(": ")
+	if e.Rule != "" {
+		fmt.Fprintf(&b, "rule %s ", e.Rule)
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, "%s: ", e.Field)
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// LoadErrors 加载规则文件时发现的所有错误
+type LoadErrors []*LoadError
+
+func (e LoadErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// LoadRuleFiles 读取并编译规则文件，所有文件都没有错误时返回规则集，
+// 否则返回LoadErrors，包含所有文件中的所有错误
+func LoadRuleFiles(paths ...string) (*RuleSet, error) {
+	var (
+		rules []*NamedRule
+		errs  LoadErrors
+	)
+	ids := map[string]*LoadError{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, &LoadError{File: path, Err: err})
+			continue
+		}
+		rs, es := parseRuleFile(path, data, ids)
+		rules, errs = append(rules, rs...), append(errs, es...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	s := NewRuleSet()
+	if err := s.Add(rules...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadRuleDir 加载目录中所有.yaml、.yml、.json规则文件，按文件名顺序，不包括子目录
+func LoadRuleDir(dir string) (*RuleSet, error) {
+	files, err := ruleFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return LoadRuleFiles(files...)
+}
+
+// ruleFiles 目录中的规则文件，按文件名排序
+func ruleFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !e.IsDir() {
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// ParseRuleFile 解析并编译一个规则文件的内容，name用于错误信息，有错误时返回LoadErrors
+func ParseRuleFile(name string, data []byte) ([]*NamedRule, error) {
+	rules, errs := parseRuleFile(name, data, map[string]*LoadError{})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return rules, nil
+}
+
+// yamlLine yaml语法错误信息中的行号
+var yamlLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// parseRuleFile ids记录已经定义的规则ID和位置，用于发现跨文件的重复ID
+func parseRuleFile(name string, data []byte, ids map[string]*LoadError) ([]*NamedRule, LoadErrors) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		e := &LoadError{File: name, Err: err}
+		if m := yamlLine.FindStringSubmatch(err.Error()); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Err = errors.New(err.Error()[len(m[0]):])
+		}
+		return nil, LoadErrors{e}
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	var errs LoadErrors
+	at := func(n *yaml.Node, rule, field string, err error) {
+		errs = append(errs, &LoadError{File: name, Line: n.Line, Column: n.Column, Rule: rule, Field: field, Err: err})
+	}
+	list := doc.Content[0]
+	if list.Kind == yaml.MappingNode {
+		for i := 0; i < len(list.Content); i += 2 {
+			if k := list.Content[i]; k.Value != "rules" {
+				at(k, "", "", fmt.Errorf("unknown field %q", k.Value))
+			}
+		}
+		list = mappingValue(list, "rules")
+		if list == nil {
+			return nil, errs
+		}
+	}
+	if list.Kind != yaml.SequenceNode {
+		at(list, "", "", errors.New("rules must be a list"))
+		return nil, errs
+	}
+	var rules []*NamedRule
+	for _, item := range list.Content {
+		if item.Kind != yaml.MappingNode {
+			at(item, "", "", errors.New("rule must be a mapping"))
+			continue
+		}
+		for i := 0; i < len(item.Content); i += 2 {
+			if k := item.Content[i]; !ruleFields[k.Value] {
+				at(k, "", "", fmt.Errorf("unknown field %q", k.Value))
+			}
+		}
+		var d RuleDef
+		if err := item.Decode(&d); err != nil {
+			at(item, "", "", err)
+			continue
+		}
+		ok := true
+		r := d.compile(func(field, key string, err error) {
+			ok = false
+			n := mappingValue(item, field)
+			if key != "" {
+				n = mappingValue(n, key)
+				field += "." + key
+			}
+			if n == nil {
+				n = item
+			}
+			at(n, d.ID, field, err)
+		})
+		if d.ID != "" {
+			n := mappingValue(item, "id")
+			if first, dup := ids[d.ID]; dup {
+				ok = false
+				at(n, d.ID, "id", fmt.Errorf("%w, first defined at %s:%d", ErrDuplicateRule, first.File, first.Line))
+			} else {
+				ids[d.ID] = &LoadError{File: name, Line: n.Line}
+			}
+		}
+		if ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules, errs
+}
+
+// mappingValue mapping中key对应的值，不存在时返回nil
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
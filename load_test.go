@@ -0,0 +1,117 @@
+package gorules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeRuleFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRuleFiles(t *testing.T) {
+	dir := t.TempDir()
+	y := writeRuleFile(t, dir, "a.yaml", `
+rules:
+  - id: vip
+    description: vip discount
+    tags: [discount]
+    priority: 10
+    when: level >= 3 && amount > 100
+    value: amount * 0.1
+    then:
+      reason: '"vip"'
+    effective_from: 2024-01-01T00:00:00Z
+  - id: off
+    disabled: true
+    when: "true"
+`)
+	j := writeRuleFile(t, dir, "b.json", `{
+	"rules": [
+		{"id": "big", "when": "amount > 1000", "effective_to": "2030-01-01T00:00:00Z"}
+	]
+}`)
+	s, err := LoadRuleFiles(y, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, r := range s.Rules() {
+		ids = append(ids, r.ID)
+	}
+	if want := []string{"vip", "off", "big"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("rules = %v, want %v", ids, want)
+	}
+	vip, _ := s.Get("vip")
+	if vip.Priority != 10 || !vip.HasTag("discount") || vip.Value == nil || vip.Then["reason"] == nil ||
+		!vip.EffectiveFrom.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("vip = %+v", vip)
+	}
+	if off, _ := s.Get("off"); off.Enabled {
+		t.Error("off should be disabled")
+	}
+	if big, _ := s.Get("big"); big.ActiveAt(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("big should expire at 2030")
+	}
+}
+
+func TestLoadRuleFiles_errors(t *testing.T) {
+	dir := t.TempDir()
+	a := writeRuleFile(t, dir, "a.yaml", `- id: a
+  when: x >
+  then:
+    ok: "1"
+    bad: y + (2
+- id: b
+  when: x > 1
+  priorty: 3
+- when: x > 1
+- id: c
+  when: x > 1
+  effective_from: 2024-01-01T00:00:00Z
+  effective_to: 2023-01-01T00:00:00Z
+`)
+	b := writeRuleFile(t, dir, "b.yaml", `rules:
+  - id: b
+    when: x > 2
+`)
+	c := writeRuleFile(t, dir, "c.yaml", "rules: [\n")
+	_, err := LoadRuleFiles(a, b, c, filepath.Join(dir, "missing.yaml"))
+	var errs LoadErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error = %v, want LoadErrors", err)
+	}
+	want := []struct {
+		file   string
+		line   int
+		field  string
+		target error
+	}{
+		{file: a, line: 2, field: "when"},
+		{file: a, line: 5, field: "then.bad"},
+		{file: a, line: 8},
+		{file: a, line: 9, field: "id", target: ErrRuleID},
+		{file: a, line: 13, field: "effective_to", target: ErrEffectiveTime},
+		{file: b, line: 2, field: "id", target: ErrDuplicateRule},
+		{file: c, line: 1},
+		{file: filepath.Join(dir, "missing.yaml"), target: os.ErrNotExist},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errors:\n%v\nwant %d errors", err, len(want))
+	}
+	for i, w := range want {
+		e := errs[i]
+		if e.File != w.file || e.Line != w.line || e.Field != w.field || w.target != nil && !errors.Is(e, w.target) {
+			t.Errorf("error %d = %v, want %s:%d %s %v", i, e, w.file, w.line, w.field, w.target)
+		}
+	}
+}
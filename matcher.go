@@ -0,0 +1,303 @@
+package gorules
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Matcher 大量规则的索引匹配：分析每条规则顶层&&中的一个条件建立索引，
+// field == 常量、in(field, 常量)用哈希索引，field与数值常量比较用区间索引，
+// 匹配时只对索引选出的候选规则求值，没有可索引条件的规则总是候选。
+//
+// 规则为true时顶层&&的每个条件都为true，所以候选规则包含了所有匹配的规则，
+// Match的结果与按顺序对每条启用并且在有效期内的规则调用Bool、收集返回(true, nil)的规则完全一致
+type Matcher struct {
+	ids    []string
+	times  []period
+	rules  []Rule
+	paths  []*pathIndex
+	always []int
+}
+
+// pathIndex 一个字段路径上的索引，get取出事件中该字段的值
+type pathIndex struct {
+	path  string
+	get   *rule
+	eqStr map[string][]int
+	eqNum map[float64][]int
+	inStr map[string][]int
+	inNum map[float64][]int
+	lower []bound // field > v、field >= v，按v升序
+	upper []bound // field < v、field <= v，按v降序
+}
+
+// bound 区间索引的一个端点
+type bound struct {
+	v    float64
+	open bool
+	rule int
+}
+
+// MatcherStats 索引的统计
+type MatcherStats struct {
+	Rules     int
+	Indexed   int
+	Unindexed int
+	Paths     int
+}
+
+// NewMatcher 为规则集中启用的规则建立索引，规则按加入顺序编号，有效期在Match时判断
+func NewMatcher(s *RuleSet) (*Matcher, error) {
+	m := &Matcher{}
+	paths := map[string]*pathIndex{}
+	for _, r := range s.Rules() {
+		if !r.Enabled {
+			continue
+		}
+		i := len(m.rules)
+		m.ids = append(m.ids, r.ID)
+		m.times = append(m.times, r.period())
+		m.rules = append(m.rules, r.Rule)
+		p, ok := accessPredicate(r.Rule)
+		if !ok {
+			m.always = append(m.always, i)
+			continue
+		}
+		idx, ok := paths[p.path]
+		if !ok {
+			get, err := newRule(p.path, nil)
+			if err != nil {
+				return nil, err
+			}
+			idx = &pathIndex{path: p.path, get: get}
+			paths[p.path] = idx
+			m.paths = append(m.paths, idx)
+		}
+		idx.add(p, i)
+	}
+	for _, idx := range m.paths {
+		sort.SliceStable(idx.lower, func(i, j int) bool { return idx.lower[i].v < idx.lower[j].v })
+		sort.SliceStable(idx.upper, func(i, j int) bool { return idx.upper[i].v > idx.upper[j].v })
+	}
+	return m, nil
+}
+
+// Stats 有多少规则用上了索引
+func (m *Matcher) Stats() MatcherStats {
+	return MatcherStats{
+		Rules:     len(m.rules),
+		Indexed:   len(m.rules) - len(m.always),
+		Unindexed: len(m.always),
+		Paths:     len(m.paths),
+	}
+}
+
+// Match 返回匹配x的规则ID，按规则加入的顺序排列。求值出错的规则视为不匹配
+func (m *Matcher) Match(x interface{}) []string {
+	return m.MatchAt(x, time.Time{})
+}
+
+// MatchAt 与Match相同，按时间at判断规则的有效期，at为零值时使用当前时间
+func (m *Matcher) MatchAt(x interface{}, at time.Time) []string {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	candidates := append([]int(nil), m.always...)
+	for _, idx := range m.paths {
+		candidates = idx.candidates(x, candidates)
+	}
+	sort.Ints(candidates)
+	var matched []string
+	last := -1
+	for _, i := range candidates {
+		if i == last {
+			continue
+		}
+		last = i
+		if !m.times[i].activeAt(at) {
+			continue
+		}
+		if ok, err := m.rules[i].Bool(x); ok && err == nil {
+			matched = append(matched, m.ids[i])
+		}
+	}
+	return matched
+}
+
+// candidates 取出事件中字段的值，把索引命中的规则追加到out
+func (idx *pathIndex) candidates(x interface{}, out []int) []int {
+	v, err := idx.get.evalValue(x)
+	if err != nil {
+		return out
+	}
+	// 与compareValues一致：字段是字符串时只和字符串常量相等，否则按数值比较
+	if s, ok := v.string(); ok {
+		out = append(out, idx.eqStr[s]...)
+	} else if f, err := v.number(); err == nil && f == f {
+		out = append(out, idx.eqNum[f]...)
+		for _, b := range idx.lower {
+			if b.v > f {
+				break
+			}
+			if b.v < f || !b.open {
+				out = append(out, b.rule)
+			}
+		}
+		for _, b := range idx.upper {
+			if b.v < f {
+				break
+			}
+			if b.v > f || !b.open {
+				out = append(out, b.rule)
+			}
+		}
+	}
+	// 与isIn一致：按slice的元素类型比较
+	if len(idx.inStr) == 0 && len(idx.inNum) == 0 {
+		return out
+	}
+	sv := v.reflect()
+	if sv.Kind() != reflect.Slice && sv.Kind() != reflect.Array {
+		return out
+	}
+	for i := 0; i < sv.Len(); i++ {
+		e := sv.Index(i)
+		switch e.Kind() {
+		case reflect.String:
+			out = append(out, idx.inStr[e.String()]...)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			out = append(out, idx.inNum[float64(e.Int())]...)
+		case reflect.Float32, reflect.Float64:
+			out = append(out, idx.inNum[e.Float()]...)
+		}
+	}
+	return out
+}
+
+func (idx *pathIndex) add(p predicate, i int) {
+	s, isStr := p.lit.string()
+	f, _ := p.lit.number()
+	switch {
+	case p.in && isStr:
+		idx.inStr = addPosting(idx.inStr, s, i)
+	case p.in:
+		idx.inNum = addPosting(idx.inNum, f, i)
+	}
+	switch p.op {
+	case token.EQL:
+		if isStr {
+			idx.eqStr = addPosting(idx.eqStr, s, i)
+		} else {
+			idx.eqNum = addPosting(idx.eqNum, f, i)
+		}
+	case token.GTR, token.GEQ:
+		idx.lower = append(idx.lower, bound{v: f, open: p.op == token.GTR, rule: i})
+	case token.LSS, token.LEQ:
+		idx.upper = append(idx.upper, bound{v: f, open: p.op == token.LSS, rule: i})
+	}
+}
+
+func addPosting[K comparable](m map[K][]int, k K, i int) map[K][]int {
+	if m == nil {
+		m = map[K][]int{}
+	}
+	m[k] = append(m[k], i)
+	return m
+}
+
+// predicate 可索引的条件：path op lit，in为true时表示in(path, lit)
+type predicate struct {
+	path string
+	op   token.Token
+	in   bool
+	lit  value
+}
+
+// rank 条件的选择性，相等最好，区间最差
+func (p predicate) rank() int {
+	switch {
+	case p.op == token.EQL:
+		return 3
+	case p.in:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// flipped 常量在左侧时交换两侧后的比较运算符
+var flipped = map[token.Token]token.Token{
+	token.EQL: token.EQL,
+	token.LSS: token.GTR, token.LEQ: token.GEQ, token.GTR: token.LSS, token.GEQ: token.LEQ,
+}
+
+// accessPredicate 从规则顶层的&&中选出选择性最好的可索引条件。
+// 只分析没有let的规则，let变量可能遮住同名字段
+func accessPredicate(r Rule) (predicate, bool) {
+	ru, ok := r.(*rule)
+	if !ok || len(ru.lets) > 0 {
+		return predicate{}, false
+	}
+	cp := &compiler{scope: scope{}, consts: ru.consts}
+	var best predicate
+	found := false
+	for _, c := range conjuncts(ru.expr, nil) {
+		p, ok := cp.predicate(c)
+		if ok && (!found || p.rank() > best.rank()) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+func conjuncts(expr ast.Expr, out []ast.Expr) []ast.Expr {
+	expr = unparen(expr)
+	if b, ok := expr.(*ast.BinaryExpr); ok && b.Op == token.LAND {
+		return conjuncts(b.Y, conjuncts(b.X, out))
+	}
+	return append(out, expr)
+}
+
+func (cp *compiler) predicate(expr ast.Expr) (predicate, bool) {
+	switch t := expr.(type) {
+	case *ast.BinaryExpr:
+		op, ok := flipped[t.Op]
+		if !ok {
+			return predicate{}, false
+		}
+		if p, ok := cp.pathLit(t.X, t.Y, t.Op); ok {
+			return p, true
+		}
+		return cp.pathLit(t.Y, t.X, op)
+	case *ast.CallExpr:
+		if f, ok := t.Fun.(*ast.Ident); ok && strings.ToUpper(f.Name) == "IN" && len(t.Args) == 2 {
+			p, ok := cp.pathLit(t.Args[0], t.Args[1], token.ILLEGAL)
+			p.in = true
+			return p, ok
+		}
+	}
+	return predicate{}, false
+}
+
+// pathLit x是字段路径、y是字符串或数值常量，op为token.ILLEGAL表示in，区间只支持数值
+func (cp *compiler) pathLit(x, y ast.Expr, op token.Token) (predicate, bool) {
+	x, y = unparen(x), unparen(y)
+	path, ok := cp.fieldPath(x)
+	if !ok {
+		return predicate{}, false
+	}
+	lit, ok := cp.consts[y]
+	if !ok {
+		return predicate{}, false
+	}
+	_, isStr := lit.string()
+	_, err := lit.number()
+	if !isStr && err != nil || isStr && op != token.EQL && op != token.ILLEGAL {
+		return predicate{}, false
+	}
+	return predicate{path: path, op: op, lit: lit}, true
+}
@@ -0,0 +1,164 @@
+package gorules
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type adEvent struct {
+	Age    int      `json:"age"`
+	Region string   `json:"region"`
+	Score  float64  `json:"score"`
+	Tags   []string `json:"tags"`
+	Ids    []int64  `json:"ids"`
+	Geo    struct {
+		City string `json:"city"`
+	} `json:"geo"`
+}
+
+var (
+	testRegions = []string{"north", "south", "east", "west"}
+	testTags    = []string{"sport", "music", "game", "news"}
+)
+
+// randomPredicate 随机的条件，包括可索引和不可索引的
+func randomPredicate(r *rand.Rand) string {
+	switch r.Intn(12) {
+	case 0:
+		return fmt.Sprintf("age == %d", r.Intn(60))
+	case 1:
+		return fmt.Sprintf("%d <= age", r.Intn(60))
+	case 2:
+		return fmt.Sprintf("age < %d", r.Intn(60))
+	case 3:
+		return fmt.Sprintf("region == %q", testRegions[r.Intn(4)])
+	case 4:
+		return fmt.Sprintf("in(tags, %q)", testTags[r.Intn(4)])
+	case 5:
+		return fmt.Sprintf("in(ids, %d)", r.Intn(10))
+	case 6:
+		return fmt.Sprintf("score > %d.5", r.Intn(100))
+	case 7:
+		return fmt.Sprintf("geo.city == %q", testRegions[r.Intn(4)])
+	case 8:
+		return fmt.Sprintf("(age > %d || region == %q)", r.Intn(60), testRegions[r.Intn(4)])
+	case 9:
+		return fmt.Sprintf("age != %d", r.Intn(60))
+	case 10:
+		return "missing > 1"
+	default:
+		return fmt.Sprintf("region == %d", r.Intn(3))
+	}
+}
+
+func randomRuleSet(t testing.TB, r *rand.Rand, n int) *RuleSet {
+	s := NewRuleSet()
+	for i := 0; i < n; i++ {
+		preds := make([]string, 1+r.Intn(3))
+		for j := range preds {
+			preds[j] = randomPredicate(r)
+		}
+		src := strings.Join(preds, " && ")
+		if r.Intn(20) == 0 {
+			src = "let a = age; a > 30 && " + src
+		}
+		nr, err := NewNamedRule(fmt.Sprintf("r%d", i), src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nr.Enabled = r.Intn(50) != 0
+		if err := s.Add(nr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func randomEvent(r *rand.Rand) interface{} {
+	e := adEvent{Age: r.Intn(60), Region: testRegions[r.Intn(4)], Score: float64(r.Intn(200)) / 2}
+	for i := r.Intn(3); i > 0; i-- {
+		e.Tags = append(e.Tags, testTags[r.Intn(4)])
+		e.Ids = append(e.Ids, int64(r.Intn(10)))
+	}
+	e.Geo.City = testRegions[r.Intn(4)]
+	if r.Intn(10) == 0 {
+		return map[string]interface{}{"age": e.Age, "region": e.Region, "missing": 2}
+	}
+	return &e
+}
+
+func TestMatcher_sameAsBool(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := randomRuleSet(t, r, 2000)
+	m, err := NewMatcher(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := m.Stats(); st.Indexed == 0 || st.Unindexed == 0 || st.Indexed+st.Unindexed != st.Rules {
+		t.Errorf("Stats() = %+v", st)
+	}
+	for i := 0; i < 300; i++ {
+		x := randomEvent(r)
+		var want []string
+		for _, nr := range s.Rules() {
+			if ok, err := nr.Rule.Bool(x); nr.Enabled && ok && err == nil {
+				want = append(want, nr.ID)
+			}
+		}
+		if got := m.Match(x); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Match(%+v) = %v, want %v", x, got, want)
+		}
+	}
+}
+
+func TestMatcher_predicate(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{rule: `age > 1 && region == "north"`, want: `region == north`},
+		{rule: `age > 1 && in(tags, "a")`, want: `in(tags, a)`},
+		{rule: `18 <= age`, want: `age >= 18`},
+		{rule: `geo.city == "x"`, want: `geo.city == x`},
+		{rule: `age == 1 + 2`, want: `age == 3`},
+		{rule: `region > "a"`},
+		{rule: `age > 1 || region == "north"`},
+		{rule: `$p == 1`},
+		{rule: `let a = 1; a == 1`},
+	}
+	for _, tt := range tests {
+		r, err := NewRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if p, ok := accessPredicate(r); ok && p.in {
+			got = fmt.Sprintf("in(%s, %v)", p.path, p.lit.iface())
+		} else if ok {
+			got = fmt.Sprintf("%s %s %v", p.path, p.op, p.lit.iface())
+		}
+		if got != tt.want {
+			t.Errorf("%s accessPredicate() = %q, want %q", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	s := randomRuleSet(b, r, 50000)
+	m, err := NewMatcher(s)
+	if err != nil {
+		b.Fatal(err)
+	}
+	events := make([]interface{}, 100)
+	for i := range events {
+		events[i] = randomEvent(r)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Match(events[i%len(events)])
+	}
+}
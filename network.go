@@ -0,0 +1,239 @@
+package gorules
+
+import (
+	"fmt"
+	"go/ast"
+	"strconv"
+	"time"
+)
+
+// Network 规则网络：把规则集中启用的规则一起编译，文本相同的子表达式（忽略括号和空白）
+// 只编译成一个节点，每次Match每个节点最多计算一次，结果供所有引用它的规则使用。
+//
+// 节点仍按原规则的求值顺序按需计算，规则出错后它余下的节点不再计算，
+// 所以Match的结果与按加入顺序对每条启用并且在有效期内的规则调用Bool完全一致。
+// 引用let变量的子表达式只在同一条规则内共享；绑定了输入类型的规则和字节码规则不参与共享，单独求值
+type Network struct {
+	ids   []string
+	times []period
+	rules []netRule
+	keys  map[string]*netNode
+	nodes int
+	refs  int
+	rule  int
+}
+
+// netRule 网络中的一条规则，opaque不为nil时单独求值
+type netRule struct {
+	lets   []evalFunc
+	fn     evalFunc
+	opaque Rule
+}
+
+// netNode 一个不同的子表达式，常量不占用memo，
+// size是节点连同它的子表达式中非常量子表达式的个数，复用节点时全部计入引用次数
+type netNode struct {
+	fn       evalFunc
+	refs     int
+	size     int
+	constant bool
+	value    value
+}
+
+// memoValue 节点在一次Match中的结果
+type memoValue struct {
+	done bool
+	v    value
+	err  error
+}
+
+// NetworkStats 网络的共享情况：References是所有规则中非常量子表达式出现的次数，
+// 包括复用的节点下面没有再编译的子表达式，Nodes是不同的子表达式个数，Shared是被多次引用的节点个数
+type NetworkStats struct {
+	Rules      int
+	Opaque     int
+	References int
+	Nodes      int
+	Shared     int
+}
+
+// Saved 共享节省的求值次数占比
+func (s NetworkStats) Saved() float64 {
+	if s.References == 0 {
+		return 0
+	}
+	return float64(s.References-s.Nodes) / float64(s.References)
+}
+
+// NewNetwork 编译规则集中启用的规则，规则按加入顺序编号，有效期在Match时判断
+func NewNetwork(s *RuleSet) (*Network, error) {
+	n := &Network{keys: map[string]*netNode{}}
+	for _, r := range s.Rules() {
+		if !r.Enabled {
+			continue
+		}
+		n.rule = len(n.rules)
+		nr, err := n.compile(r.Rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		n.ids = append(n.ids, r.ID)
+		n.times = append(n.times, r.period())
+		n.rules = append(n.rules, nr)
+	}
+	return n, nil
+}
+
+func (n *Network) compile(r Rule) (netRule, error) {
+	ru, ok := r.(*rule)
+	if !ok || ru.input != nil {
+		return netRule{opaque: r}, nil
+	}
+	cp := &compiler{scope: scope{}, net: n}
+	var nr netRule
+	for i, l := range ru.lets {
+		fn, err := cp.compile(l.expr)
+		if err != nil {
+			return netRule{}, err
+		}
+		cp.scope[l.name] = i
+		nr.lets = append(nr.lets, fn)
+	}
+	fn, err := cp.compile(ru.expr)
+	if err != nil {
+		return netRule{}, err
+	}
+	nr.fn = fn
+	return nr, nil
+}
+
+// node 返回表达式的共享节点，第一次出现时编译。
+// 节点的key是从ast按规范格式输出的文本，字符串字面量不会和外部参数混淆
+func (n *Network) node(cp *compiler, expr ast.Expr) (evalFunc, error) {
+	key := exprText(expr)
+	if usesScope(expr, cp.scope) {
+		key = strconv.Itoa(n.rule) + "|" + key
+	}
+	if nd, ok := n.keys[key]; ok {
+		nd.refs++
+		n.refs += nd.size
+		if nd.constant {
+			return cp.constant(expr, nd.value), nil
+		}
+		return nd.fn, nil
+	}
+	before := n.refs
+	fn, err := cp.compileNode(expr)
+	if err != nil {
+		return nil, err
+	}
+	nd := &netNode{fn: fn, refs: 1}
+	if v, ok := cp.consts[expr]; ok {
+		nd.constant, nd.value = true, v
+		n.refs = before
+	} else {
+		nd.fn = memoize(fn, n.nodes)
+		n.nodes++
+		n.refs++
+		nd.size = n.refs - before
+	}
+	n.keys[key] = nd
+	return nd.fn, nil
+}
+
+// memoize 第id个节点，同一次Match中只计算一次
+func memoize(fn evalFunc, id int) evalFunc {
+	return func(c *evalContext) (value, error) {
+		if id >= len(c.memo) {
+			return fn(c)
+		}
+		m := &c.memo[id]
+		if !m.done {
+			m.v, m.err = fn(c)
+			m.done = true
+		}
+		return m.v, m.err
+	}
+}
+
+// usesScope 表达式是否引用了let变量
+func usesScope(expr ast.Expr, sc scope) bool {
+	if len(sc) == 0 {
+		return false
+	}
+	found := false
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if id, ok := node.(*ast.Ident); ok {
+			if _, ok := sc[id.Name]; ok {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// Stats 规则网络的共享统计
+func (n *Network) Stats() NetworkStats {
+	st := NetworkStats{Rules: len(n.rules), References: n.refs, Nodes: n.nodes}
+	for _, r := range n.rules {
+		if r.opaque != nil {
+			st.Opaque++
+		}
+	}
+	for _, nd := range n.keys {
+		if !nd.constant && nd.refs > 1 {
+			st.Shared++
+		}
+	}
+	return st
+}
+
+// Match 返回为true的规则ID，按规则加入的顺序排列，与RuleSet.Match(x, MatchAll)一致，
+// 规则求值出错时返回错误
+func (n *Network) Match(x interface{}) ([]string, error) {
+	return n.MatchAt(x, time.Time{})
+}
+
+// MatchAt 与Match相同，按时间at判断规则的有效期，at为零值时使用当前时间，
+// 与RuleSet.MatchAt(x, MatchAll, at)一致
+func (n *Network) MatchAt(x interface{}, at time.Time) ([]string, error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	c := getContext(x)
+	defer putContext(c)
+	if cap(c.memo) < n.nodes {
+		c.memo = make([]memoValue, n.nodes)
+	}
+	c.memo = c.memo[:n.nodes]
+	var matched []string
+	for i, r := range n.rules {
+		if !n.times[i].activeAt(at) {
+			continue
+		}
+		ok, err := r.match(c, x)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", n.ids[i], err)
+		}
+		if ok {
+			matched = append(matched, n.ids[i])
+		}
+	}
+	return matched, nil
+}
+
+func (r netRule) match(c *evalContext, x interface{}) (bool, error) {
+	if r.opaque != nil {
+		return r.opaque.Bool(x)
+	}
+	c.locals = c.locals[:0]
+	for _, l := range r.lets {
+		v, err := l(c)
+		if err != nil {
+			return false, err
+		}
+		c.locals = append(c.locals, v)
+	}
+	return boolResult(r.fn(c))
+}
@@ -0,0 +1,154 @@
+package gorules
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNetwork_sameAsRuleSet(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		s := randomRuleSet(t, r, 1+r.Intn(10))
+		if r.Intn(4) == 0 {
+			typed, _ := NewRuleFor(adEvent{}, "age > 20")
+			if err := s.Add(&NamedRule{ID: "typed", Enabled: true, Rule: typed}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		n, err := NewNetwork(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 20; j++ {
+			x := randomEvent(r)
+			var want []string
+			matched, wantErr := s.Match(x, MatchAll)
+			for _, nr := range matched {
+				want = append(want, nr.ID)
+			}
+			got, err := n.Match(x)
+			if fmt.Sprint(err) != fmt.Sprint(wantErr) || !reflect.DeepEqual(got, want) {
+				t.Fatalf("Match(%+v) = %v, %v, want %v, %v", x, got, err, want, wantErr)
+			}
+		}
+	}
+}
+
+func TestNetwork_Stats(t *testing.T) {
+	s := NewRuleSet()
+	for i, src := range []string{
+		`region == "CN" && age > 18`,
+		`(region == "CN") && age > 30`,
+		`let a = age; a > 18 && region=="CN"`,
+		`let region = age; region == 30`,
+	} {
+		nr, err := NewNamedRule(fmt.Sprintf("r%d", i), src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Add(nr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := NewNetwork(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := NetworkStats{Rules: 4, References: 19, Nodes: 12, Shared: 2}
+	if st := n.Stats(); st != want {
+		t.Errorf("Stats() = %+v, want %+v", st, want)
+	}
+	tests := []struct {
+		x    interface{}
+		want []string
+	}{
+		{x: map[string]interface{}{"region": "CN", "age": 20}, want: []string{"r0", "r2"}},
+		{x: map[string]interface{}{"region": "CN", "age": 30}, want: []string{"r0", "r2", "r3"}},
+		{x: map[string]interface{}{"region": "US", "age": 30}, want: []string{"r3"}},
+	}
+	for _, tt := range tests {
+		got, err := n.Match(tt.x)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Match(%v) = %v, %v, want %v", tt.x, got, err, tt.want)
+		}
+	}
+}
+
+func TestNetwork_keys(t *testing.T) {
+	s := NewRuleSet()
+	for i, src := range []string{`c == "__param_x"`, `c == "$x"`, `c == $x`, "c == `$x`"} {
+		nr, err := NewNamedRule(fmt.Sprintf("r%d", i), src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Add(nr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := NewNetwork(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := n.Match(Env{Input: map[string]interface{}{"c": "$x"}, Vars: Vars{"x": "y"}})
+	if want := []string{"r1", "r3"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Match() = %v, %v, want %v", got, err, want)
+	}
+	if st := n.Stats(); st.Nodes != 5 || st.Shared != 2 {
+		t.Errorf("Stats() = %+v, want 5 nodes, 2 shared", st)
+	}
+}
+
+func TestNetwork_MatchAt(t *testing.T) {
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewRuleSet()
+	for _, d := range []RuleDef{
+		{ID: "expired", When: "age > 18", EffectiveTo: &jan},
+		{ID: "pending", When: "age > 18", EffectiveFrom: &jan},
+		{ID: "always", When: "age > 18"},
+	} {
+		nr, err := d.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Add(nr)
+	}
+	n, err := NewNetwork(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMatcher(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := map[string]interface{}{"age": 20}
+	tests := []struct {
+		at   time.Time
+		want []string
+	}{
+		{at: jan.Add(-time.Hour), want: []string{"expired", "always"}},
+		{at: jan, want: []string{"pending", "always"}},
+		{want: []string{"pending", "always"}},
+	}
+	for _, tt := range tests {
+		var want []string
+		matched, _ := s.MatchAt(x, MatchAll, tt.at)
+		for _, nr := range matched {
+			want = append(want, nr.ID)
+		}
+		if !reflect.DeepEqual(want, tt.want) {
+			t.Fatalf("RuleSet.MatchAt(%v) = %v, want %v", tt.at, want, tt.want)
+		}
+		if got, err := n.MatchAt(x, tt.at); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Network.MatchAt(%v) = %v, %v, want %v", tt.at, got, err, tt.want)
+		}
+		if got := m.MatchAt(x, tt.at); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Matcher.MatchAt(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+	if got, err := n.Match(x); err != nil || !reflect.DeepEqual(got, []string{"pending", "always"}) {
+		t.Errorf("Network.Match() = %v, %v", got, err)
+	}
+}
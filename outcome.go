@@ -0,0 +1,200 @@
+package gorules
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RuleDef 规则的定义：条件When和匹配后的结果，字段都是规则表达式的源码，
+// 可以直接从配置文件解码。EffectiveFrom、EffectiveTo是规则的有效期，为空表示不限制，
+// 保存到RuleStore时Version由存储分配
+type RuleDef struct {
+	ID            string            `json:"id" yaml:"id"`
+	Version       int               `json:"version,omitempty" yaml:"version,omitempty"`
+	Description   string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags          []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Priority      int               `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Disabled      bool              `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	When          string            `json:"when" yaml:"when"`
+	Value         string            `json:"value,omitempty" yaml:"value,omitempty"`
+	Then          map[string]string `json:"then,omitempty" yaml:"then,omitempty"`
+	Action        string            `json:"action,omitempty" yaml:"action,omitempty"`
+	EffectiveFrom *time.Time        `json:"effective_from,omitempty" yaml:"effective_from,omitempty"`
+	EffectiveTo   *time.Time        `json:"effective_to,omitempty" yaml:"effective_to,omitempty"`
+}
+
+// Compile 编译条件和所有结果表达式，返回第一个错误
+func (d RuleDef) Compile() (*NamedRule, error) {
+	var first error
+	r := d.compile(func(field, key string, err error) {
+		if first != nil {
+			return
+		}
+		switch field {
+		case "when", "id":
+			first = fmt.Errorf("rule %s: %w", d.ID, err)
+		case "then":
+			first = fmt.Errorf("rule %s then %s: %w", d.ID, key, err)
+		default:
+			first = fmt.Errorf("rule %s %s: %w", d.ID, field, err)
+		}
+	})
+	if first != nil {
+		return nil, first
+	}
+	return r, nil
+}
+
+// compile 编译所有表达式，每个出错的字段调用一次report，key是Then中的键。
+// 有错误时返回的规则不完整
+func (d RuleDef) compile(report func(field, key string, err error)) *NamedRule {
+	r := &NamedRule{ID: d.ID, Version: d.Version, Description: d.Description, Tags: d.Tags, Priority: d.Priority,
+		Enabled: !d.Disabled, Action: d.Action}
+	var err error
+	if d.ID == "" {
+		report("id", "", ErrRuleID)
+	}
+	if r.Rule, err = NewRule(d.When); err != nil {
+		report("when", "", err)
+	}
+	if d.Value != "" {
+		if r.Value, err = NewRule(d.Value); err != nil {
+			report("value", "", err)
+		}
+	}
+	if len(d.Then) > 0 {
+		r.Then = make(map[string]Rule, len(d.Then))
+		keys := make([]string, 0, len(d.Then))
+		for k := range d.Then {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if r.Then[k], err = NewRule(d.Then[k]); err != nil {
+				report("then", k, err)
+			}
+		}
+	}
+	if d.EffectiveFrom != nil {
+		r.EffectiveFrom = *d.EffectiveFrom
+	}
+	if d.EffectiveTo != nil {
+		r.EffectiveTo = *d.EffectiveTo
+	}
+	if d.EffectiveFrom != nil && d.EffectiveTo != nil && !d.EffectiveTo.After(*d.EffectiveFrom) {
+		report("effective_to", "", ErrEffectiveTime)
+	}
+	return r
+}
+
+// Action 规则匹配后调用的回调，x是求值的输入，res中已经计算好Value和Values
+type Action func(x interface{}, res *Result) error
+
+// Result 一条匹配规则的结果
+type Result struct {
+	Rule   *NamedRule
+	Value  interface{}
+	Values map[string]interface{}
+}
+
+// SetAction 注册回调，规则的Action按名字引用，fn为nil时删除
+func (s *RuleSet) SetAction(name string, fn Action) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fn == nil {
+		delete(s.actions, name)
+		return
+	}
+	s.actions[name] = fn
+}
+
+// copyActions 复制from中注册的回调，s还没有交给其他goroutine使用
+func (s *RuleSet) copyActions(from *RuleSet) {
+	from.mu.RLock()
+	defer from.mu.RUnlock()
+	for name, fn := range from.actions {
+		s.actions[name] = fn
+	}
+}
+
+// Results 按mode匹配规则，对每条匹配的规则计算结果并调用回调
+func (s *RuleSet) Results(x interface{}, mode MatchMode) ([]*Result, error) {
+	matched, err := s.Match(x, mode)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*Result, 0, len(matched))
+	for _, r := range matched {
+		res, err := s.outcome(x, r)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// Decide 返回优先级最高的匹配规则的结果，没有匹配时返回nil
+func (s *RuleSet) Decide(x interface{}) (*Result, error) {
+	results, err := s.Results(x, MatchFirst)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+func (s *RuleSet) outcome(x interface{}, r *NamedRule) (*Result, error) {
+	res, err := evalOutcome(x, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.runAction(x, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// evalOutcome 计算规则的Value和Then，不调用回调
+func evalOutcome(x interface{}, r *NamedRule) (*Result, error) {
+	res := &Result{Rule: r}
+	var err error
+	if r.Value != nil {
+		if res.Value, err = r.Value.Eval(x); err != nil {
+			return nil, fmt.Errorf("rule %s value: %w", r.ID, err)
+		}
+	}
+	if len(r.Then) > 0 {
+		res.Values = make(map[string]interface{}, len(r.Then))
+		// 按key的顺序计算，多个输出出错时总是返回同一个错误
+		keys := make([]string, 0, len(r.Then))
+		for k := range r.Then {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if res.Values[k], err = r.Then[k].Eval(x); err != nil {
+				return nil, fmt.Errorf("rule %s then %s: %w", r.ID, k, err)
+			}
+		}
+	}
+	return res, nil
+}
+
+// runAction 调用规则的回调，规则没有回调时什么也不做
+func (s *RuleSet) runAction(x interface{}, res *Result) error {
+	r := res.Rule
+	if r.Action == "" {
+		return nil
+	}
+	s.mu.RLock()
+	fn, ok := s.actions[r.Action]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("rule %s: %w: %s", r.ID, ErrNotFoundAction, r.Action)
+	}
+	if err := fn(x, res); err != nil {
+		return fmt.Errorf("rule %s action %s: %w", r.ID, r.Action, err)
+	}
+	return nil
+}
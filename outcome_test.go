@@ -0,0 +1,95 @@
+package gorules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRuleSet_Decide(t *testing.T) {
+	type order struct {
+		Price float64 `json:"price"`
+		Vip   bool    `json:"vip"`
+	}
+	defs := []RuleDef{
+		{ID: "vip", When: "vip", Priority: 10, Then: map[string]string{"discount": "price * 0.1", "reason": `"vip"`}, Action: "notify"},
+		{ID: "big", When: "price > 1000", Value: "price * 0.05"},
+		{ID: "off", When: "price > 0", Disabled: true, Value: "1"},
+	}
+	s := NewRuleSet()
+	for _, d := range defs {
+		r, err := d.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Decide(order{Price: 200, Vip: true}); !errors.Is(err, ErrNotFoundAction) {
+		t.Errorf("Decide() error = %v, want ErrNotFoundAction", err)
+	}
+	var notified []string
+	s.SetAction("notify", func(x interface{}, res *Result) error {
+		notified = append(notified, res.Values["reason"].(string))
+		return nil
+	})
+
+	res, err := s.Decide(order{Price: 2000, Vip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"discount": float64(200), "reason": "vip"}; res.Rule.ID != "vip" || !reflect.DeepEqual(res.Values, want) {
+		t.Errorf("Decide() = %s %v, want vip %v", res.Rule.ID, res.Values, want)
+	}
+	if !reflect.DeepEqual(notified, []string{"vip"}) {
+		t.Errorf("notified = %v", notified)
+	}
+
+	results, err := s.Results(order{Price: 2000, Vip: true}, MatchAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[1].Rule.ID != "big" || results[1].Value != float64(100) || results[1].Values != nil {
+		t.Errorf("Results() = %+v", results[1])
+	}
+
+	if res, err := s.Decide(order{Price: 10}); err != nil || res != nil {
+		t.Errorf("Decide() = %v, %v, want nil", res, err)
+	}
+	s.SetAction("notify", func(interface{}, *Result) error { return errors.New("boom") })
+	if _, err := s.Decide(order{Vip: true}); err == nil {
+		t.Errorf("Decide() want action error")
+	}
+}
+
+func TestRuleDef_Compile(t *testing.T) {
+	tests := []RuleDef{
+		{ID: "a", When: "a >"},
+		{ID: "a", When: "a > 1", Value: "a +"},
+		{ID: "a", When: "a > 1", Then: map[string]string{"x": "in(a"}},
+	}
+	for _, d := range tests {
+		if _, err := d.Compile(); err == nil {
+			t.Errorf("Compile(%+v) want error", d)
+		}
+	}
+}
+
+func TestRuleSet_Decide_thenErrorOrder(t *testing.T) {
+	d := RuleDef{ID: "a", When: "a > 0", Then: map[string]string{"z": "missing_z", "m": "missing_m", "b": "missing_b", "x": "a"}}
+	r, err := d.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewRuleSet()
+	if err := s.Add(r); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		_, err := s.Decide(evalType{A: 1})
+		if err == nil || err.Error() != "rule a then b: not found tag" {
+			t.Fatalf("Decide() error = %v, want rule a then b: not found tag", err)
+		}
+	}
+}
@@ -2,24 +2,202 @@ package gorules
 
 import (
 	"errors"
+	"fmt"
 	"go/ast"
+	"go/scanner"
 	"go/token"
 	"reflect"
-	"strconv"
 	"strings"
 )
 
 // 错误定义
 var (
-	ErrRuleEmpty      = errors.New("rule is empty")
-	ErrTypeNotStruct  = errors.New("value must struct or struct pointer")
-	ErrNotFoundTag    = errors.New("not found tag")
-	ErrUnsupportToken = errors.New("unsupport token")
-	ErrUnsupportExpr  = errors.New("unsupport expr")
-	ErrNotNumber      = errors.New("not a number")
-	ErrNotBool        = errors.New("not boolean")
+	ErrRuleEmpty        = errors.New("rule is empty")
+	ErrTypeNotStruct    = errors.New("value must struct or struct pointer")
+	ErrNotFoundTag      = errors.New("not found tag")
+	ErrUnsupportToken   = errors.New("unsupport token")
+	ErrUnsupportExpr    = errors.New("unsupport expr")
+	ErrNotNumber        = errors.New("not a number")
+	ErrNotBool          = errors.New("not boolean")
+	ErrNotFoundVar      = errors.New("not found var")
+	ErrInvalidLet       = errors.New("invalid let")
+	ErrDivZero          = errors.New("x/0 error")
+	ErrInputType        = errors.New("input type mismatch")
+	ErrTypeMismatch     = errors.New("type mismatch")
+	ErrNilPointer       = errors.New("nil pointer")
+	ErrNotSlice         = errors.New("only slice or array can get value by index")
+	ErrIndexOutOfRange  = errors.New("slice index out of range")
+	ErrIndexNotNumber   = errors.New("index must be int or float")
+	ErrInNotSlice       = errors.New("function IN first param must be slice or array")
+	ErrInElemType       = errors.New("function IN only support: string int float")
+	ErrResultNotBool    = errors.New("result not bool")
+	ErrResultNotInt     = errors.New("result not int")
+	ErrResultNotFloat   = errors.New("result not float")
+	ErrResultNotString  = errors.New("result not string")
+	ErrResultNotStrings = errors.New("result not strings")
+	ErrStepLimit        = errors.New("instruction limit exceeded")
+	ErrInvalidProgram   = errors.New("invalid program")
+	ErrRuleID           = errors.New("rule id is empty")
+	ErrDuplicateRule    = errors.New("duplicate rule id")
+	ErrNotFoundAction   = errors.New("not found action")
+	ErrInvalidCell      = errors.New("invalid decision table cell")
+	ErrNotUnique        = errors.New("more than one row matched")
+	ErrReservedName     = errors.New("name is reserved")
+	ErrCycleLimit       = errors.New("inference cycle limit exceeded")
+	ErrEffectiveTime    = errors.New("effective_to must be after effective_from")
+	ErrNotFoundRule     = errors.New("not found rule")
+	ErrInvalidAST       = errors.New("invalid rule ast")
+	ErrJSONLogic        = errors.New("unsupported jsonlogic")
 )
 
+// paramPrefix 规则中的外部参数$name改写为合法的Go标识符后再交给go/parser
+const paramPrefix = "__param_"
+
+// Vars 求值时传入的外部参数，规则中以$name引用
+type Vars map[string]interface{}
+
+// Env 求值环境，作为Bool/Int/Float等方法的参数传入：Input是规则字段所在的对象，Vars是外部参数
+type Env struct {
+	Input interface{}
+	Vars  Vars
+}
+
+// Roots 多个命名的输入对象，规则的第一个标识符选择对象，如 user.age >= 18 && order.total > user.credit_limit
+// 可以直接作为Bool等方法的参数，也可以作为Env.Input
+type Roots map[string]interface{}
+
+// evalContext 一次求值的上下文，locals按编译时分配的下标保存let变量的值，
+// stack是字节码执行时的操作数栈，memo保存规则网络中已经计算过的节点
+type evalContext struct {
+	base   reflect.Value
+	vars   Vars
+	locals []value
+	stack  []value
+	memo   []memoValue
+}
+
+func (c *evalContext) reset(x interface{}) {
+	switch e := x.(type) {
+	case Env:
+		x, c.vars = e.Input, e.Vars
+	case *Env:
+		x, c.vars = e.Input, e.Vars
+	}
+	c.base = reflect.ValueOf(x)
+	if c.base.Kind() == reflect.Ptr {
+		c.base = c.base.Elem()
+	}
+}
+
+func (c *evalContext) getVar(name string) (value, error) {
+	v, ok := c.vars[name]
+	if !ok {
+		return value{}, fmt.Errorf("%w: $%s", ErrNotFoundVar, name)
+	}
+	return toValue(v), nil
+}
+
+// rewriteParams 把$name改写为paramPrefix+name，字符串字面量中的$不受影响。
+// 规则中本来就以paramPrefix开头的标识符会与外部参数混淆，返回ErrReservedName
+func rewriteParams(src string) (string, error) {
+	if !strings.Contains(src, "$") && !strings.Contains(src, paramPrefix) {
+		return src, nil
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), func(token.Position, string) {}, 0)
+
+	var b strings.Builder
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.IDENT && strings.HasPrefix(lit, paramPrefix) {
+			return "", fmt.Errorf("%w: %s", ErrReservedName, lit)
+		}
+		if tok != token.ILLEGAL || lit != "$" {
+			continue
+		}
+		off := file.Offset(pos)
+		if off+1 < len(src) && isIdentStart(src[off+1]) {
+			b.WriteString(src[last:off])
+			b.WriteString(paramPrefix)
+			last = off + 1
+		}
+	}
+	b.WriteString(src[last:])
+	return b.String(), nil
+}
+
+// splitStatements 按分号拆分规则，字符串字面量中的分号不受影响，空语句忽略
+func splitStatements(src string) []string {
+	if !strings.Contains(src, ";") {
+		return []string{src}
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), func(token.Position, string) {}, 0)
+
+	var stmts []string
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.SEMICOLON || lit != ";" {
+			continue
+		}
+		off := file.Offset(pos)
+		if stmt := strings.TrimSpace(src[last:off]); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		last = off + 1
+	}
+	if stmt := strings.TrimSpace(src[last:]); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+// splitLet 拆解 let name = expr，不是let语句时ok为false
+func splitLet(stmt string) (name, expr string, ok bool) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(stmt))
+	var s scanner.Scanner
+	s.Init(file, []byte(stmt), func(token.Position, string) {}, 0)
+
+	if _, tok, lit := s.Scan(); tok != token.IDENT || lit != "let" {
+		return "", "", false
+	}
+	_, tok, name := s.Scan()
+	if tok != token.IDENT {
+		return "", "", false
+	}
+	pos, tok, _ := s.Scan()
+	if tok != token.ASSIGN {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(stmt[file.Offset(pos)+1:]), true
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
+
+// Eval 返回规则rule的原始结果
+func Eval(base interface{}, rule string) (interface{}, error) {
+	r, err := NewRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	return r.Eval(base)
+}
+
 // Bool 规则rule结果的布尔值，rule的参数基于base的json tag
 func Bool(base interface{}, rule string) (bool, error) {
 	r, err := NewRule(rule)
@@ -50,146 +228,136 @@ func Float(base interface{}, rule string) (float64, error) {
 // 拆解rule，支持的计算类型+-*/， && ||，其他报错
 // 支持二元操作
 
-// 从struct解析找到json Tag, 若嵌套struct则用“.”连接
+// 从struct解析找到json Tag, 若嵌套struct则用“.”连接，字段下标按类型缓存
+// key为字符串的map按key取值
 func getValueByTag(x reflect.Value, tag string) (interface{}, error) {
-	if x.Kind() == reflect.Ptr {
+	v, err := lookupField(x, tag)
+	if err != nil {
+		return nil, err
+	}
+	return v.iface(), nil
+}
+
+func lookupField(x reflect.Value, tag string) (value, error) {
+	if x.Kind() == reflect.Ptr || x.Kind() == reflect.Interface {
+		if x.IsNil() {
+			return value{}, ErrNilPointer
+		}
 		x = x.Elem()
 	}
+	if x.Kind() == reflect.Map && x.Type().Key().Kind() == reflect.String {
+		v := x.MapIndex(reflect.ValueOf(tag).Convert(x.Type().Key()))
+		if !v.IsValid() {
+			return value{}, ErrNotFoundTag
+		}
+		return refValue(v), nil
+	}
 	if x.Kind() != reflect.Struct {
-		return x, ErrTypeNotStruct
+		return value{}, ErrTypeNotStruct
 	}
-	t := x.Type()
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		js := getTagName(field.Tag)
-		if js == tag {
-			return x.Field(i).Interface(), nil
-		}
-
+	idx, ok := cachedFields(x.Type())[tag]
+	if !ok {
+		return value{}, ErrNotFoundTag
 	}
-	return nil, ErrNotFoundTag
+	return fieldByIndex(x, idx)
 }
 
-func getSliceValue(x reflect.Value, idx int) (interface{}, error) {
-	if x.Kind() != reflect.Slice && x.Kind() != reflect.Array {
-		return nil, errors.New("only slice or array can get value by index")
+// fieldByIndex 按下标路径取字段，x可以是struct指针
+func fieldByIndex(x reflect.Value, idx []int) (value, error) {
+	if x.Kind() == reflect.Ptr {
+		if x.IsNil() {
+			return value{}, ErrNilPointer
+		}
+		x = x.Elem()
+	}
+	if x.Kind() != reflect.Struct {
+		return value{}, ErrTypeNotStruct
 	}
-	if idx > x.Len()-1 {
-		return nil, errors.New("slice index out of range")
+	if len(idx) == 1 {
+		return refValue(x.Field(idx[0])), nil
 	}
-	return x.Index(idx).Interface(), nil
-
+	f, err := x.FieldByIndexErr(idx)
+	if err != nil {
+		return value{}, ErrNilPointer
+	}
+	return refValue(f), nil
 }
 
-func getValue(base reflect.Value, expr ast.Expr) (interface{}, error) {
-	nullValue := reflect.Value{}
-	switch t := expr.(type) {
-	case *ast.BinaryExpr:
-		x, err := getValue(base, t.X)
-		if err != nil {
-			return nullValue, err
-		}
-		y, err := getValue(base, t.Y)
-		if err != nil {
-			return nullValue, err
-		}
-		return operate(x, y, t.Op)
-	case *ast.Ident:
-		return getValueByTag(base, t.Name)
-	case *ast.BasicLit:
-		switch t.Kind {
-		case token.STRING:
-			return strings.Trim(t.Value, "\""), nil
-		case token.INT:
-			return strconv.ParseInt(t.Value, 10, 64)
-		case token.FLOAT:
-			return strconv.ParseFloat(t.Value, 64)
-		default:
-			return nullValue, errors.New("unsupport param")
-		}
-	case *ast.ParenExpr:
-		return getValue(base, t.X)
-	case *ast.SelectorExpr:
-		v, err := getValue(base, t.X)
-		if err != nil {
-			return nullValue, err
-		}
-		return getValueByTag(reflect.ValueOf(v), t.Sel.Name)
-	case *ast.IndexExpr:
-		idx, err := getValue(base, t.Index)
-		if err != nil {
-			return nullValue, err
-		}
-		f, ok := idx.(float64)
-		if !ok {
-			if i, ok := idx.(int64); ok {
-				f = float64(i)
-			} else {
-				return nullValue, errors.New("index must be int or float")
-			}
-
-		}
-		v, err := getValue(base, t.X)
-		if err != nil {
-			return nullValue, err
-		}
-		return getSliceValue(reflect.ValueOf(v), int(f))
-	case *ast.CallExpr:
-		if fexp, ok := t.Fun.(*ast.Ident); ok {
-			if strings.ToUpper(fexp.Name) == "IN" {
-				if len(t.Args) == 2 {
-					return isIn(base, t.Args[0], t.Args[1])
-				}
-				return nullValue, errors.New("function IN only support tow params")
-			}
-			return nullValue, errors.New("unsupport function: " + fexp.Name)
-		}
-		return nullValue, errors.New("unknow function")
-	default:
-		return nullValue, ErrUnsupportExpr
+func getSliceValue(x reflect.Value, idx int) (value, error) {
+	if x.Kind() != reflect.Slice && x.Kind() != reflect.Array {
+		return value{}, ErrNotSlice
+	}
+	if idx < 0 || idx > x.Len()-1 {
+		return value{}, ErrIndexOutOfRange
 	}
+	return refValue(x.Index(idx)), nil
 }
 
-func isIn(base reflect.Value, slice ast.Expr, key ast.Expr) (bool, error) {
-	sv, err := getValue(base, slice)
+// getValue 编译并计算表达式，用于单独计算一个表达式的场景
+func getValue(base reflect.Value, expr ast.Expr) (interface{}, error) {
+	fn, err := (&compiler{}).compile(expr)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-
-	kv, err := getValue(base, key)
+	v, err := fn(&evalContext{base: base})
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	svv := reflect.ValueOf(sv)
+	return v.iface(), nil
+}
+
+func isIn(sv, kv value) (bool, error) {
+	svv := sv.reflect()
 	if svv.Kind() != reflect.Slice && svv.Kind() != reflect.Array {
-		return false, errors.New("function IN first param must be slice or array")
+		return false, ErrInNotSlice
 	}
 	if svv.Len() == 0 {
 		return false, nil
 	}
-	kvv := reflect.ValueOf(kv)
 
-	switch svv.Index(0).Kind() {
+	switch svv.Type().Elem().Kind() {
 	case reflect.String:
+		k, ok := kv.string()
+		if !ok {
+			return false, nil
+		}
 		for i := 0; i < svv.Len(); i++ {
-			if svv.Index(i).String() == kvv.String() {
+			if svv.Index(i).String() == k {
 				return true, nil
 			}
 		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		k, err := kv.number()
+		if err != nil {
+			return false, err
+		}
+		for i := 0; i < svv.Len(); i++ {
+			if float64(svv.Index(i).Int()) == k {
+				return true, nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		k, err := kv.number()
+		if err != nil {
+			return false, err
+		}
 		for i := 0; i < svv.Len(); i++ {
-			if svv.Index(i).Int() == kvv.Int() {
+			if float64(svv.Index(i).Uint()) == k {
 				return true, nil
 			}
 		}
 	case reflect.Float32, reflect.Float64:
+		k, err := kv.number()
+		if err != nil {
+			return false, err
+		}
 		for i := 0; i < svv.Len(); i++ {
-			if svv.Index(i).Float() == kvv.Float() {
+			if svv.Index(i).Float() == k {
 				return true, nil
 			}
 		}
 	default:
-		return false, errors.New("function IN only support: string int float")
+		return false, ErrInElemType
 	}
 	return false, nil
 }
@@ -38,6 +38,35 @@ func Test_getValueByTag(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "embedded",
+			args: args{
+				x: reflect.ValueOf(struct {
+					WithInt
+				}{WithInt{456}}),
+				tag: "int_value",
+			},
+			want: int64(456),
+		},
+		{
+			name: "nil embedded pointer",
+			args: args{
+				x: reflect.ValueOf(struct {
+					*WithInt
+				}{}),
+				tag: "int_value",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "map",
+			args: args{
+				x:   reflect.ValueOf(map[string]interface{}{"int_value": 7}),
+				tag: "int_value",
+			},
+			want: 7,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -53,6 +82,59 @@ func Test_getValueByTag(t *testing.T) {
 	}
 }
 
+func Test_cachedFields(t *testing.T) {
+	type Inner struct {
+		X int64 `json:"x"`
+		Y int64 `json:"y"`
+	}
+	type Base struct {
+		ID   int64 `json:"id"`
+		Name string
+	}
+	type Node struct {
+		*Node
+		V int64 `json:"v"`
+	}
+	type Outer struct {
+		Base
+		*Inner
+		Y      string `rule:"y" json:"yy"`
+		Nested Inner  `json:"nested"`
+		hidden int64  `rule:"hidden"`
+		Skip   int64  `json:"-"`
+	}
+	tests := []struct {
+		name string
+		typ  reflect.Type
+		want typeFields
+	}{
+		{
+			name: "embedded and nested",
+			typ:  reflect.TypeOf(Outer{}),
+			want: typeFields{
+				"id":       {0, 0},
+				"x":        {1, 0},
+				"y":        {2},
+				"nested":   {3},
+				"nested.x": {3, 0},
+				"nested.y": {3, 1},
+			},
+		},
+		{
+			name: "recursive",
+			typ:  reflect.TypeOf(Node{}),
+			want: typeFields{"v": {1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cachedFields(tt.typ); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cachedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_getValue(t *testing.T) {
 	type args struct {
 		base reflect.Value
@@ -445,3 +527,49 @@ func BenchmarkPreParse(b *testing.B) {
 // BenchmarkPreParse-4   	  100000	     13693 ns/op	     432 B/op	      38 allocs/op
 // BenchmarkPreParse-4   	  100000	     13846 ns/op	     384 B/op	      35 allocs/op
 // BenchmarkPreParse-4   	  100000	     11428 ns/op	     384 B/op	      35 allocs/op
+
+func BenchmarkTypedRule(b *testing.B) {
+	e := example{
+		A: 12,
+		B: 25,
+		C: "xxx",
+		Xyz: xyz{
+			X: []int64{3, 18, 274, 74, 1837},
+			Y: []float64{47, 284.13, 458.0},
+			Z: []string{"abc", "xyz", "xxx"},
+		},
+	}
+	r, err := NewRuleFor(e, "a+b>xyz.x[1] && in(xyz.z,c) && xyz.y[2]<a*b")
+	if err != nil {
+		b.Error(err)
+	}
+	for i := 0; i < b.N; i++ {
+		_, err = r.Bool(&e)
+	}
+	if err != nil {
+		b.Error(err)
+	}
+}
+
+func BenchmarkProgram(b *testing.B) {
+	e := example{
+		A: 12,
+		B: 25,
+		C: "xxx",
+		Xyz: xyz{
+			X: []int64{3, 18, 274, 74, 1837},
+			Y: []float64{47, 284.13, 458.0},
+			Z: []string{"abc", "xyz", "xxx"},
+		},
+	}
+	r, err := NewProgram("a+b>xyz.x[1] && in(xyz.z,c) && xyz.y[2]<a*b")
+	if err != nil {
+		b.Error(err)
+	}
+	for i := 0; i < b.N; i++ {
+		_, err = r.Bool(&e)
+	}
+	if err != nil {
+		b.Error(err)
+	}
+}
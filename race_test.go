@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package gorules
+
+// raceEnabled 竞态检测下sync.Pool会随机丢弃对象，分配次数不稳定
+const raceEnabled = true
@@ -1,80 +1,310 @@
 package gorules
 
 import (
-	"errors"
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"reflect"
+	"strings"
 )
 
 // Rule ...
 type Rule interface {
+	// Eval 返回规则的原始结果：运算结果为float64/bool，字段与字面量保持原类型
+	Eval(interface{}) (interface{}, error)
 	Bool(interface{}) (bool, error)
 	Int(interface{}) (int64, error)
 	Float(interface{}) (float64, error)
+	String(interface{}) (string, error)
+	Strings(interface{}) ([]string, error)
+	// Warnings 编译时发现的问题，如恒真、恒假的条件
+	Warnings() []string
 }
+
+// TypedRule 绑定了输入类型并通过静态类型检查的规则
+type TypedRule interface {
+	Rule
+	InputType() reflect.Type
+	ResultType() reflect.Type
+}
+
+// rule 保留ast的同时保存编译好的闭包，求值时只调用闭包
 type rule struct {
+	lets     []binding
+	expr     ast.Expr
+	fn       evalFunc
+	input    reflect.Type
+	result   reflect.Type
+	warnings []string
+	// consts 编译时折叠出的常量，生成字节码时直接作为常量
+	consts map[ast.Expr]value
+}
+
+// binding 规则中的 let name = expr，每次求值按顺序计算一次
+type binding struct {
+	name string
 	expr ast.Expr
+	fn   evalFunc
 }
 
 // NewRule 提前解析规则,不用每次都重新解析
+// 规则可以用分号分隔，最后一句是结果表达式，之前的语句用let定义局部变量：
+// let margin = (price - cost) / price; margin > 0.2 && margin < 0.6
 func NewRule(r string) (Rule, error) {
+	ru, err := newRule(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
+
+// NewRuleFor 把规则绑定到输入类型typ，typ可以是reflect.Type或该类型的一个值（指针会解引用）。
+// 编译时检查所有标识符、字段选择、下标和运算符的类型，字段下标在编译时确定，
+// 求值时输入必须是该类型或其指针，否则返回ErrInputType
+func NewRuleFor(typ interface{}, r string) (TypedRule, error) {
+	t, err := inputType(typ)
+	if err != nil {
+		return nil, err
+	}
+	ru, err := newRule(r, t)
+	if err != nil {
+		return nil, err
+	}
+	return ru, nil
+}
+
+// inputType typ是reflect.Type或该类型的一个值，指针解引用
+func inputType(typ interface{}) (reflect.Type, error) {
+	t, ok := typ.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(typ)
+	}
+	if t == nil {
+		return nil, ErrInputType
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t, nil
+}
+
+func newRule(r string, input reflect.Type) (*rule, error) {
 	if len(r) == 0 {
 		return nil, ErrRuleEmpty
 	}
-	expr, err := parser.ParseExpr(r)
+	src, err := rewriteParams(r)
 	if err != nil {
 		return nil, err
 	}
-	return &rule{expr}, nil
+	stmts := splitStatements(src)
+	if len(stmts) == 0 {
+		return nil, ErrRuleEmpty
+	}
+	ru := &rule{input: input}
+	cp := newCompiler(input)
+	for _, stmt := range stmts[:len(stmts)-1] {
+		name, src, ok := splitLet(stmt)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidLet, stmt)
+		}
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := ru.let(cp, name, expr); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, ok := splitLet(stmts[len(stmts)-1]); ok {
+		return nil, fmt.Errorf("%w: rule must end with an expression", ErrInvalidLet)
+	}
+	expr, err := parser.ParseExpr(stmts[len(stmts)-1])
+	if err != nil {
+		return nil, err
+	}
+	if err := ru.body(cp, expr); err != nil {
+		return nil, err
+	}
+	return ru, nil
 }
 
-func (r *rule) Bool(x interface{}) (bool, error) {
-	typ := reflect.ValueOf(x)
-	if typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
+// let 编译 let name = expr
+func (ru *rule) let(cp *compiler, name string, expr ast.Expr) error {
+	if _, ok := cp.scope[name]; ok || strings.HasPrefix(name, paramPrefix) {
+		return fmt.Errorf("%w: duplicate or reserved name %s", ErrInvalidLet, name)
 	}
-	b, err := getValue(typ, r.expr)
+	fn, err := cp.build(expr, false)
 	if err != nil {
-		return false, err
+		return err
 	}
-	if r, ok := b.(bool); ok {
-		return r, nil
+	cp.scope[name] = len(ru.lets)
+	cp.letTypes = append(cp.letTypes, cp.types[expr])
+	ru.lets = append(ru.lets, binding{name, expr, fn})
+	return nil
+}
+
+// body 编译结果表达式
+func (ru *rule) body(cp *compiler, expr ast.Expr) error {
+	fn, err := cp.build(expr, true)
+	if err != nil {
+		return err
 	}
-	return false, errors.New("result not bool")
+	ru.expr, ru.fn, ru.result, ru.warnings, ru.consts = expr, fn, cp.types[expr], cp.warnings, cp.consts
+	return nil
+}
+
+// InputType 规则绑定的输入类型，NewRule创建的规则返回nil
+func (r *rule) InputType() reflect.Type {
+	return r.input
 }
 
+func (r *rule) Warnings() []string {
+	return r.warnings
+}
+
+// ResultType 类型检查推导出的结果类型，无法静态确定时返回nil
+func (r *rule) ResultType() reflect.Type {
+	return r.result
+}
+
+// Eval x可以是规则字段所在的对象，也可以是携带外部参数的Env
+func (r *rule) Eval(x interface{}) (interface{}, error) {
+	v, err := r.evalValue(x)
+	if err != nil {
+		return nil, err
+	}
+	return v.iface(), nil
+}
+
+// evalValue 求值过程不装箱，结果为bool或数值时整个过程不分配内存
+func (r *rule) evalValue(x interface{}) (value, error) {
+	c := getContext(x)
+	defer putContext(c)
+	if r.input != nil && (!c.base.IsValid() || c.base.Type() != r.input) {
+		return value{}, ErrInputType
+	}
+	for _, l := range r.lets {
+		v, err := l.fn(c)
+		if err != nil {
+			return value{}, err
+		}
+		c.locals = append(c.locals, v)
+	}
+	return r.fn(c)
+}
+
+func (r *rule) Bool(x interface{}) (bool, error) {
+	return boolResult(r.evalValue(x))
+}
+
+// Int 数值结果转换为int64，浮点数截断小数部分
 func (r *rule) Int(x interface{}) (int64, error) {
-	typ := reflect.ValueOf(x)
-	if typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
+	return intResult(r.evalValue(x))
+}
+
+func (r *rule) Float(x interface{}) (float64, error) {
+	return floatResult(r.evalValue(x))
+}
+
+// String 结果必须是字符串（包括以string为底层类型的自定义类型）
+func (r *rule) String(x interface{}) (string, error) {
+	return stringResult(r.evalValue(x))
+}
+
+// Strings 结果必须是元素为字符串的slice或array
+func (r *rule) Strings(x interface{}) ([]string, error) {
+	return stringsResult(r.Eval(x))
+}
+
+func boolResult(v value, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	if b, ok := v.boolean(); ok {
+		return b, nil
+	}
+	return false, ErrResultNotBool
+}
+
+func intResult(v value, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if v.kind == kindRef {
+		switch v.ref.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return v.ref.Int(), nil
+		}
 	}
-	b, err := getValue(typ, r.expr)
+	f, err := v.number()
+	if err != nil {
+		return 0, ErrResultNotInt
+	}
+	return int64(f), nil
+}
+
+func floatResult(v value, err error) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	if r, ok := b.(float64); ok {
-		return int64(r), nil
-	} else if i, ok := b.(int64); ok {
-		return i, nil
+	f, err := v.number()
+	if err != nil {
+		return 0, ErrResultNotFloat
 	}
-	return 0, errors.New("result not int")
+	return f, nil
 }
 
-func (r *rule) Float(x interface{}) (float64, error) {
-	typ := reflect.ValueOf(x)
-	if typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
+func stringResult(v value, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if s, ok := v.string(); ok {
+		return s, nil
 	}
-	b, err := getValue(typ, r.expr)
+	return "", ErrResultNotString
+}
+
+func stringsResult(b interface{}, err error) ([]string, error) {
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if s, ok := b.([]string); ok {
+		return s, nil
+	}
+	v := reflect.ValueOf(b)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() != reflect.String {
+		return nil, ErrResultNotStrings
+	}
+	s := make([]string, v.Len())
+	for i := range s {
+		s[i] = v.Index(i).String()
+	}
+	return s, nil
+}
+
+// EvalAs 计算规则并把结果转换为T，转换规则：
+//   - 结果可以直接赋值给T时原样返回（T为interface类型时总是成立）
+//   - 数值结果可以转换为任意数值类型T，浮点转整数时截断小数部分，与Int一致
+//   - 字符串结果可以转换为底层类型为string的T
+//   - 其他情况返回错误，不做数值与字符串、布尔之间的隐式转换
+func EvalAs[T any](r Rule, x interface{}) (T, error) {
+	var zero T
+	b, err := r.Eval(x)
+	if err != nil {
+		return zero, err
+	}
+	if t, ok := b.(T); ok {
+		return t, nil
 	}
-	if r, ok := b.(float64); ok {
-		return r, nil
+	to := reflect.TypeOf(&zero).Elem()
+	v := reflect.ValueOf(b)
+	if !v.IsValid() {
+		return zero, fmt.Errorf("result nil can not convert to %s", to)
 	}
-	if r, ok := b.(int64); ok {
-		return float64(r), nil
+	if v.Type().AssignableTo(to) || (isNumberKind(v.Kind()) && isNumberKind(to.Kind())) ||
+		(v.Kind() == reflect.String && to.Kind() == reflect.String) {
+		reflect.ValueOf(&zero).Elem().Set(v.Convert(to))
+		return zero, nil
 	}
-	return 0, errors.New("result not float")
+	return zero, fmt.Errorf("result %s can not convert to %s", v.Type(), to)
 }
@@ -0,0 +1,541 @@
+package gorules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type evalType struct {
+	A int64    `json:"a"`
+	B float64  `json:"b"`
+	C string   `json:"c"`
+	D []string `json:"d"`
+	E []int64  `json:"e"`
+	F xyz      `json:"f"`
+}
+
+func TestRule_Eval(t *testing.T) {
+	base := evalType{A: 3, B: 1.5, C: "abc", D: []string{"x", "y"}, E: []int64{7}, F: xyz{Z: []string{"z"}}}
+	tests := []struct {
+		name    string
+		rule    string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "field int", rule: "a", want: int64(3)},
+		{name: "math", rule: "a*b", want: float64(4.5)},
+		{name: "bool", rule: "a>b", want: true},
+		{name: "string", rule: "c", want: "abc"},
+		{name: "string literal", rule: `"xyz"`, want: "xyz"},
+		{name: "slice", rule: "d", want: []string{"x", "y"}},
+		{name: "struct", rule: "f", want: xyz{Z: []string{"z"}}},
+		{name: "index", rule: "e[0]", want: int64(7)},
+		{name: "not found", rule: "g", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := r.Eval(&base)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRule_String(t *testing.T) {
+	type name string
+	type named struct {
+		N name      `json:"n"`
+		L []name    `json:"l"`
+		A [2]string `json:"a"`
+		I int       `json:"i"`
+	}
+	base := named{N: "tom", L: []name{"a", "b"}, A: [2]string{"c", "d"}, I: 1}
+
+	r, _ := NewRule("n")
+	if s, err := r.String(base); err != nil || s != "tom" {
+		t.Errorf("String() = %v, %v", s, err)
+	}
+	r, _ = NewRule("i")
+	if _, err := r.String(base); err == nil {
+		t.Errorf("String() of int want error")
+	}
+	r, _ = NewRule("l")
+	if s, err := r.Strings(base); err != nil || !reflect.DeepEqual(s, []string{"a", "b"}) {
+		t.Errorf("Strings() = %v, %v", s, err)
+	}
+	r, _ = NewRule("a")
+	if s, err := r.Strings(base); err != nil || !reflect.DeepEqual(s, []string{"c", "d"}) {
+		t.Errorf("Strings() = %v, %v", s, err)
+	}
+	r, _ = NewRule("n")
+	if _, err := r.Strings(base); err == nil {
+		t.Errorf("Strings() of string want error")
+	}
+}
+
+func TestEvalAs(t *testing.T) {
+	base := evalType{A: 3, B: 1.5, C: "abc", D: []string{"x"}}
+	mustRule := func(s string) Rule {
+		r, err := NewRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	if v, err := EvalAs[int](mustRule("a*b"), base); err != nil || v != 4 {
+		t.Errorf("EvalAs[int]() = %v, %v", v, err)
+	}
+	if v, err := EvalAs[float32](mustRule("a"), base); err != nil || v != 3 {
+		t.Errorf("EvalAs[float32]() = %v, %v", v, err)
+	}
+	if v, err := EvalAs[bool](mustRule("a>b"), base); err != nil || !v {
+		t.Errorf("EvalAs[bool]() = %v, %v", v, err)
+	}
+	type label string
+	if v, err := EvalAs[label](mustRule("c"), base); err != nil || v != "abc" {
+		t.Errorf("EvalAs[label]() = %v, %v", v, err)
+	}
+	if v, err := EvalAs[[]string](mustRule("d"), base); err != nil || !reflect.DeepEqual(v, []string{"x"}) {
+		t.Errorf("EvalAs[[]string]() = %v, %v", v, err)
+	}
+	if v, err := EvalAs[interface{}](mustRule("a"), base); err != nil || v != int64(3) {
+		t.Errorf("EvalAs[interface{}]() = %v, %v", v, err)
+	}
+	if _, err := EvalAs[string](mustRule("a"), base); err == nil {
+		t.Errorf("EvalAs[string]() of number want error")
+	}
+	if _, err := EvalAs[int](mustRule("a>b"), base); err == nil {
+		t.Errorf("EvalAs[int]() of bool want error")
+	}
+}
+
+func TestRule_Vars(t *testing.T) {
+	type order struct {
+		Amount float64 `json:"amount"`
+		Region string  `json:"region"`
+	}
+	r, err := NewRule(`amount > $threshold && region == $region && "$x" != region`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &order{Amount: 150, Region: "CN"}
+	tests := []struct {
+		name    string
+		env     interface{}
+		want    bool
+		wantErr bool
+	}{
+		{name: "tenant a", env: Env{Input: o, Vars: Vars{"threshold": 100, "region": "CN"}}, want: true},
+		{name: "tenant b", env: &Env{Input: o, Vars: Vars{"threshold": 200.0, "region": "CN"}}, want: false},
+		{name: "missing var", env: Env{Input: o, Vars: Vars{"threshold": 100}}, wantErr: true},
+		{name: "no env", env: o, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Bool(tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Bool() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Bool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rewriteParams(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{src: "a > b", want: "a > b"},
+		{src: "a > $b", want: "a > " + paramPrefix + "b"},
+		{src: `$a.x == "$b"`, want: paramPrefix + `a.x == "$b"`},
+		{src: "a > $ b", want: "a > $ b"},
+		{src: `c == "__param_x"`, want: `c == "__param_x"`},
+		{src: "__param_x > 1", wantErr: true},
+		{src: "a.__param_x > $b", wantErr: true},
+		{src: "$__param_x > 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := rewriteParams(tt.src)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("rewriteParams(%q) = %q, %v, want %q", tt.src, got, err, tt.want)
+		}
+	}
+	if _, err := NewRule("__param_limit > 1"); !errors.Is(err, ErrReservedName) {
+		t.Errorf("NewRule() error = %v, want ErrReservedName", err)
+	}
+}
+
+func TestRule_Roots(t *testing.T) {
+	type user struct {
+		Age         int64   `json:"age"`
+		CreditLimit float64 `json:"credit_limit"`
+	}
+	type order struct {
+		Total float64 `json:"total"`
+	}
+	r, err := NewRule("user.age >= 18 && order.total > user.credit_limit && ext.level == $level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := Roots{
+		"user":  &user{Age: 20, CreditLimit: 100},
+		"order": order{Total: 120},
+		"ext":   map[string]interface{}{"level": "gold"},
+	}
+	tests := []struct {
+		name    string
+		x       interface{}
+		want    bool
+		wantErr bool
+	}{
+		{name: "env", x: Env{Input: roots, Vars: Vars{"level": "gold"}}, want: true},
+		{name: "other level", x: Env{Input: roots, Vars: Vars{"level": "silver"}}, want: false},
+		{name: "missing root", x: Env{Input: Roots{"user": user{}}, Vars: Vars{"level": "gold"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Bool(tt.x)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Bool() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Bool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	r, _ = NewRule("user.age")
+	if v, err := r.Int(Roots{"user": user{Age: 7}}); err != nil || v != 7 {
+		t.Errorf("Int() = %v, %v", v, err)
+	}
+}
+
+func TestRule_Let(t *testing.T) {
+	type goods struct {
+		Price float64 `json:"price"`
+		Cost  float64 `json:"cost"`
+		Name  string  `json:"name"`
+	}
+	tests := []struct {
+		name       string
+		rule       string
+		want       interface{}
+		wantNewErr bool
+	}{
+		{name: "margin", rule: "let margin = (price - cost) / price; margin > 0.2 && margin < 0.6", want: true},
+		{name: "chain", rule: "let a = price - cost; let b = a * 2;\nb", want: float64(80)},
+		{name: "shadow field", rule: "let price = 1; price + cost", want: float64(61)},
+		{name: "semicolon in string", rule: `let n = "a;b"; n`, want: "a;b"},
+		{name: "param", rule: "let limit = $limit * 2; price > limit", want: true},
+		{name: "trailing semicolon", rule: "price > cost;", want: true},
+		{name: "no let", rule: "price; cost", wantNewErr: true},
+		{name: "end with let", rule: "let a = price", wantNewErr: true},
+		{name: "duplicate", rule: "let a = price; let a = cost; a", wantNewErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRule(tt.rule)
+			if (err != nil) != tt.wantNewErr {
+				t.Fatalf("NewRule() error = %v, wantErr %v", err, tt.wantNewErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := r.Eval(Env{Input: goods{Price: 100, Cost: 60}, Vars: Vars{"limit": 10}})
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRule_evalError(t *testing.T) {
+	tests := []string{
+		"a & b",
+		"max(a, b)",
+		"in(a)",
+		"a.b()",
+		"-a",
+		"let x = a & b; x",
+		"a > 2 && missing > 1",
+		"a < 2 || missing > 1",
+		"missing > 1 && a > 2",
+		"a > 2 && c",
+	}
+	for _, tt := range tests {
+		r, err := NewRule(tt)
+		if err != nil {
+			t.Fatalf("NewRule(%q) error = %v", tt, err)
+		}
+		if _, err := r.Eval(evalType{A: 1}); err == nil {
+			t.Errorf("%s Eval() want error", tt)
+		}
+	}
+}
+
+func TestRule_stringLiteral(t *testing.T) {
+	tests := []struct {
+		rule string
+		c    string
+	}{
+		{rule: `c == "abc"`, c: "abc"},
+		{rule: `c == "x\"y"`, c: `x"y`},
+		{rule: `c == "a\tb"`, c: "a\tb"},
+		{rule: "c == `a\\b`", c: `a\b`},
+		{rule: `c == "\u4e2d"`, c: "中"},
+	}
+	for _, tt := range tests {
+		r, err := NewRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := r.Bool(evalType{C: tt.c}); err != nil || !got {
+			t.Errorf("%s Bool(%q) = %v, %v, want true", tt.rule, tt.c, got, err)
+		}
+	}
+}
+
+func TestRule_concurrent(t *testing.T) {
+	r, err := NewRule("a+b>xyz.x[1] && in(xyz.z,c)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := example{A: 12, B: 25, C: "xxx", Xyz: xyz{X: []int64{3, 18}, Z: []string{"xxx"}}}
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			var err error
+			for j := 0; j < 100 && err == nil; j++ {
+				var ok bool
+				if ok, err = r.Bool(&e); err == nil && !ok {
+					err = errors.New("want true")
+				}
+			}
+			done <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestNewRuleFor(t *testing.T) {
+	type Address struct {
+		City string `json:"city"`
+	}
+	type Person struct {
+		Age     uint8             `json:"age"`
+		Score   float64           `json:"score"`
+		Name    string            `json:"name"`
+		Address *Address          `json:"address"`
+		Tags    []string          `json:"tags"`
+		Nums    []int             `json:"nums"`
+		Ids     []uint            `json:"ids"`
+		Ext     map[string]string `json:"ext"`
+		Any     interface{}       `json:"any"`
+	}
+	p := Person{
+		Age:     20,
+		Score:   3.5,
+		Name:    "tom",
+		Address: &Address{City: "bj"},
+		Tags:    []string{"vip"},
+		Nums:    []int{1, 2},
+		Ids:     []uint{7, 9},
+		Ext:     map[string]string{"lv": "gold"},
+		Any:     8,
+	}
+	tests := []struct {
+		name       string
+		rule       string
+		want       interface{}
+		wantResult reflect.Type
+		wantNewErr bool
+	}{
+		{name: "number", rule: "age + score", want: 23.5, wantResult: typeFloat},
+		{name: "compare", rule: "age > 18 && name == \"tom\"", want: true, wantResult: typeBool},
+		{name: "pointer selector", rule: "address.city", want: "bj", wantResult: typeString},
+		{name: "index", rule: "nums[1]", want: 2, wantResult: reflect.TypeOf(0)},
+		{name: "in", rule: "in(tags, \"vip\") && in(nums, age/10)", want: true, wantResult: typeBool},
+		{name: "in uint", rule: "in(ids, 9)", want: true, wantResult: typeBool},
+		{name: "not in uint", rule: "in(ids, age)", want: false, wantResult: typeBool},
+		{name: "map", rule: "ext.lv", want: "gold", wantResult: typeString},
+		{name: "interface", rule: "any > 7", want: true, wantResult: typeBool},
+		{name: "param", rule: "age > $min", want: true, wantResult: typeBool},
+		{name: "let", rule: "let s = score * 2; s > age", want: false, wantResult: typeBool},
+		{name: "bool constant", rule: "age > 18 && true", want: true, wantResult: typeBool},
+		{name: "string number compare", rule: `age > "ten"`, wantNewErr: true},
+		{name: "string less", rule: `name < "x"`, wantNewErr: true},
+		{name: "typo", rule: "adress.city", wantNewErr: true},
+		{name: "nested typo", rule: "address.cty", wantNewErr: true},
+		{name: "not bool", rule: "age && score", wantNewErr: true},
+		{name: "index not slice", rule: "name[0]", wantNewErr: true},
+		{name: "index string", rule: `nums["a"]`, wantNewErr: true},
+		{name: "in mismatch", rule: "in(tags, age)", wantNewErr: true},
+		{name: "unknown function", rule: "max(age, 1)", wantNewErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRuleFor(&Person{}, tt.rule)
+			if (err != nil) != tt.wantNewErr {
+				t.Fatalf("NewRuleFor() error = %v, wantErr %v", err, tt.wantNewErr)
+			}
+			if err != nil {
+				return
+			}
+			if r.ResultType() != tt.wantResult {
+				t.Errorf("ResultType() = %v, want %v", r.ResultType(), tt.wantResult)
+			}
+			got, err := r.Eval(Env{Input: &p, Vars: Vars{"min": 10}})
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	// 不绑定类型时in同样支持uint数组
+	untyped, err := NewRule("in(ids, 9) && in(ids, 7)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := untyped.Bool(&p); err != nil || !got {
+		t.Errorf("in uint Bool() = %v, %v, want true", got, err)
+	}
+	r, err := NewRuleFor(reflect.TypeOf(Person{}), "age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.InputType() != reflect.TypeOf(Person{}) {
+		t.Errorf("InputType() = %v", r.InputType())
+	}
+	if _, err := r.Eval(evalType{}); !errors.Is(err, ErrInputType) {
+		t.Errorf("Eval() error = %v, want %v", err, ErrInputType)
+	}
+	if _, err := r.Eval(Person{Address: nil}); err != nil {
+		t.Errorf("Eval() error = %v", err)
+	}
+	r, _ = NewRuleFor(Person{}, "address.city")
+	if _, err := r.Eval(Person{}); err == nil {
+		t.Errorf("Eval() nil pointer want error")
+	}
+}
+
+func TestNewRule_fold(t *testing.T) {
+	tests := []struct {
+		name         string
+		rule         string
+		want         interface{}
+		wantErr      bool
+		wantWarnings []string
+	}{
+		{name: "math", rule: "a > 100 * 1000", want: false},
+		{name: "paren", rule: "(2 + 3) * a", want: float64(15)},
+		{name: "true and", rule: "true && a > 2", want: true},
+		{name: "false or", rule: "a > 5 || false", want: false},
+		{name: "false and", rule: "b > 1 && (false && a > 1)", want: false, wantWarnings: []string{"false && a > 1 is always false"}},
+		{name: "false and error", rule: "false && missing > 1", wantErr: true, wantWarnings: []string{"false && missing > 1 is always false"}},
+		{name: "or true", rule: "a > 5 || true", want: true, wantWarnings: []string{"a > 5 || true is always true"}},
+		{name: "constant rule", rule: "1 > 2 || 3 > 4", want: false, wantWarnings: []string{"rule is always false"}},
+		{name: "constant and", rule: "(false && true)", want: false, wantWarnings: []string{"rule is always false"}},
+		{name: "true and not bool", rule: "true && a", wantErr: true},
+		{name: "string", rule: `"x" == "x"`, want: true, wantWarnings: []string{"rule is always true"}},
+		{name: "divide by zero", rule: "a > 1 / (2 - 2)", wantErr: true, wantWarnings: []string{"1 / (2 - 2) always fails: x/0 error"}},
+		{name: "string less", rule: `"a" < "b" || a > 1`, wantErr: true, wantWarnings: []string{`"a" < "b" always fails: unsupport token`}},
+		{name: "constant not bool", rule: "1 && a > 1", wantErr: true, wantWarnings: []string{"1 && a > 1 always fails: not boolean: 1"}},
+		{name: "not bool and error", rule: "missing > 1 || 2", wantErr: true, wantWarnings: []string{"missing > 1 || 2 always fails: not boolean: 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := r.Eval(evalType{A: 3, B: 1.5})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) && !tt.wantErr {
+				t.Errorf("Eval() = %#v, want %#v", got, tt.want)
+			}
+			if !reflect.DeepEqual(r.Warnings(), tt.wantWarnings) {
+				t.Errorf("Warnings() = %q, want %q", r.Warnings(), tt.wantWarnings)
+			}
+		})
+	}
+	r, _ := NewRule("missing > 1 || 2")
+	if _, err := r.Eval(evalType{}); !errors.Is(err, ErrNotFoundTag) {
+		t.Errorf("Eval() error = %v, want not found tag", err)
+	}
+}
+
+func TestRule_zeroAlloc(t *testing.T) {
+	e := &example{
+		A: 12,
+		B: 25,
+		C: "xxx",
+		Xyz: xyz{
+			X: []int64{3, 18, 274, 74, 1837},
+			Y: []float64{47, 284.13, 458.0},
+			Z: []string{"abc", "xyz", "xxx"},
+		},
+	}
+	tests := []struct {
+		rule string
+		eval func(Rule) error
+	}{
+		{rule: "a+b > 30 && b-a < 20", eval: func(r Rule) error { _, err := r.Bool(e); return err }},
+		{rule: "a+b>xyz.x[1] && in(xyz.z,c) && xyz.y[2]<a*b", eval: func(r Rule) error { _, err := r.Bool(e); return err }},
+		{rule: `let s = a+b; s > 30 || c == "yyy"`, eval: func(r Rule) error { _, err := r.Bool(e); return err }},
+		{rule: "(a*2 + 1000 * 3) / b", eval: func(r Rule) error { _, err := r.Float(e); return err }},
+		{rule: "xyz.x[a/4]", eval: func(r Rule) error { _, err := r.Int(e); return err }},
+	}
+	for _, tt := range tests {
+		r, err := NewRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr, err := NewRuleFor(e, tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := NewProgram(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range []Rule{r, tr, p} {
+			if err := tt.eval(r); err != nil {
+				t.Fatal(err)
+			}
+			if raceEnabled {
+				continue
+			}
+			if allocs := testing.AllocsPerRun(100, func() { _ = tt.eval(r) }); allocs != 0 {
+				t.Errorf("%s allocs = %v, want 0", tt.rule, allocs)
+			}
+		}
+	}
+}
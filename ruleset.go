@@ -0,0 +1,265 @@
+package gorules
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MatchMode 规则集的匹配方式
+type MatchMode int
+
+const (
+	// MatchFirst 按优先级从高到低求值，返回第一条匹配的规则
+	MatchFirst MatchMode = iota
+	// MatchAll 按加入顺序求值所有规则，返回所有匹配的规则
+	MatchAll
+	// MatchPriority 求值所有规则，匹配的规则按优先级从高到低返回
+	MatchPriority
+)
+
+// NamedRule 规则集中带元数据的规则，Rule的结果必须是bool
+type NamedRule struct {
+	ID string
+	// Version 规则的版本号，同一ID的多个版本由Timeline按时间选择
+	Version     int
+	Description string
+	Tags        []string
+	// Priority 数值越大越优先，相同优先级按加入顺序，加入规则集后不要再修改
+	Priority int
+	// Enabled 为false的规则不参与求值
+	Enabled bool
+	Rule    Rule
+
+	// 规则匹配后的结果：Value是结果值，Then是一组键值，Action是注册到RuleSet的回调名，都可以为空
+	Value  Rule
+	Then   map[string]Rule
+	Action string
+
+	// EffectiveFrom、EffectiveTo 规则的有效期[from, to)，零值表示不限制
+	EffectiveFrom time.Time
+	EffectiveTo   time.Time
+}
+
+// NewNamedRule 编译规则，返回启用状态的NamedRule
+func NewNamedRule(id, rule string) (*NamedRule, error) {
+	r, err := NewRule(rule)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %w", id, err)
+	}
+	return &NamedRule{ID: id, Enabled: true, Rule: r}, nil
+}
+
+// ActiveAt 时间t是否在规则的有效期内
+func (r *NamedRule) ActiveAt(t time.Time) bool {
+	return r.period().activeAt(t)
+}
+
+// period 规则的有效期[from, to)，Matcher、Network编译后按它过滤规则
+type period struct {
+	from, to time.Time
+}
+
+func (r *NamedRule) period() period {
+	return period{from: r.EffectiveFrom, to: r.EffectiveTo}
+}
+
+func (p period) activeAt(t time.Time) bool {
+	if !p.from.IsZero() && t.Before(p.from) {
+		return false
+	}
+	return p.to.IsZero() || t.Before(p.to)
+}
+
+// HasTag 规则是否带有标签tag
+func (r *NamedRule) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleSet 一组按ID管理的规则，对同一个输入求值并返回匹配的规则，可以并发使用
+type RuleSet struct {
+	mu      sync.RWMutex
+	rules   []*NamedRule // 加入顺序
+	sorted  []*NamedRule // 优先级顺序
+	byID    map[string]*NamedRule
+	actions map[string]Action
+}
+
+// NewRuleSet 创建空的规则集
+func NewRuleSet() *RuleSet {
+	return &RuleSet{byID: map[string]*NamedRule{}, actions: map[string]Action{}}
+}
+
+// Add 加入规则，ID不能为空也不能重复，有一条规则不合法时都不加入
+func (s *RuleSet) Add(rules ...*NamedRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := map[string]bool{}
+	for _, r := range rules {
+		if r.ID == "" {
+			return ErrRuleID
+		}
+		if _, ok := s.byID[r.ID]; ok || seen[r.ID] {
+			return fmt.Errorf("%w: %s", ErrDuplicateRule, r.ID)
+		}
+		if r.Rule == nil {
+			return fmt.Errorf("rule %s: %w", r.ID, ErrRuleEmpty)
+		}
+		seen[r.ID] = true
+	}
+	for _, r := range rules {
+		s.byID[r.ID] = r
+		s.rules = append(s.rules, r)
+	}
+	s.sort()
+	return nil
+}
+
+// Remove 删除规则，规则不存在时返回false
+func (s *RuleSet) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[id]; !ok {
+		return false
+	}
+	delete(s.byID, id)
+	for i, r := range s.rules {
+		if r.ID == id {
+			s.rules = append(s.rules[:i:i], s.rules[i+1:]...)
+			break
+		}
+	}
+	s.sort()
+	return true
+}
+
+// sort 按优先级排序，调用方持有写锁
+func (s *RuleSet) sort() {
+	s.sorted = append(s.sorted[:0:0], s.rules...)
+	sort.SliceStable(s.sorted, func(i, j int) bool {
+		return s.sorted[i].Priority > s.sorted[j].Priority
+	})
+}
+
+// Get 按ID查找规则
+func (s *RuleSet) Get(id string) (*NamedRule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.byID[id]
+	return r, ok
+}
+
+// SetEnabled 启用或停用规则，规则不存在时返回false
+func (s *RuleSet) SetEnabled(id string, enabled bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.byID[id]
+	if ok {
+		r.Enabled = enabled
+	}
+	return ok
+}
+
+// Rules 按加入顺序返回所有规则
+func (s *RuleSet) Rules() []*NamedRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*NamedRule(nil), s.rules...)
+}
+
+// ordered 按优先级返回启用并且在时间at有效的规则
+func (s *RuleSet) ordered(at time.Time) []*NamedRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := make([]*NamedRule, 0, len(s.sorted))
+	for _, r := range s.sorted {
+		if r.Enabled && r.ActiveAt(at) {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// Len 规则个数
+func (s *RuleSet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.rules)
+}
+
+// WithTag 返回只包含带有标签tag的规则的新规则集，新规则集持有规则元数据的副本，
+// 编译好的Rule是共享的
+func (s *RuleSet) WithTag(tag string) *RuleSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t := NewRuleSet()
+	for name, fn := range s.actions {
+		t.actions[name] = fn
+	}
+	for _, r := range s.rules {
+		if r.HasTag(tag) {
+			c := *r
+			t.byID[c.ID] = &c
+			t.rules = append(t.rules, &c)
+		}
+	}
+	t.sort()
+	return t
+}
+
+// Match 对输入x求值规则集中启用并且当前在有效期内的规则，返回匹配的规则。
+// 任何一条规则求值出错时返回该错误，错误中带有规则的ID
+func (s *RuleSet) Match(x interface{}, mode MatchMode) ([]*NamedRule, error) {
+	return s.MatchAt(x, mode, time.Time{})
+}
+
+// MatchAt 与Match相同，按时间at判断规则的有效期，at为零值时使用当前时间
+func (s *RuleSet) MatchAt(x interface{}, mode MatchMode, at time.Time) ([]*NamedRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := s.rules
+	if mode != MatchAll {
+		rules = s.sorted
+	}
+	var matched []*NamedRule
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		if !r.EffectiveFrom.IsZero() || !r.EffectiveTo.IsZero() {
+			if at.IsZero() {
+				at = time.Now()
+			}
+			if !r.ActiveAt(at) {
+				continue
+			}
+		}
+		ok, err := r.Rule.Bool(x)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		if !ok {
+			continue
+		}
+		matched = append(matched, r)
+		if mode == MatchFirst {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// First 按优先级返回第一条匹配的规则，没有匹配时返回nil
+func (s *RuleSet) First(x interface{}) (*NamedRule, error) {
+	matched, err := s.Match(x, MatchFirst)
+	if err != nil || len(matched) == 0 {
+		return nil, err
+	}
+	return matched[0], nil
+}
@@ -0,0 +1,114 @@
+package gorules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newTestRuleSet(t *testing.T) *RuleSet {
+	defs := []struct {
+		id       string
+		rule     string
+		priority int
+		tags     []string
+	}{
+		{id: "adult", rule: "age >= 18", tags: []string{"age"}},
+		{id: "senior", rule: "age >= 60", priority: 10, tags: []string{"age"}},
+		{id: "rich", rule: "income > 10000", priority: 5},
+		{id: "vip", rule: "vip", priority: 10},
+	}
+	s := NewRuleSet()
+	for _, d := range defs {
+		r, err := NewNamedRule(d.id, d.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Priority, r.Tags = d.priority, d.tags
+		if err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+type person struct {
+	Age    int     `json:"age"`
+	Income float64 `json:"income"`
+	Vip    bool    `json:"vip"`
+}
+
+func ruleIDs(rules []*NamedRule) []string {
+	ids := []string{}
+	for _, r := range rules {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestRuleSet_Match(t *testing.T) {
+	s := newTestRuleSet(t)
+	tests := []struct {
+		name string
+		x    person
+		mode MatchMode
+		want []string
+	}{
+		{name: "all", x: person{Age: 70, Income: 20000}, mode: MatchAll, want: []string{"adult", "senior", "rich"}},
+		{name: "priority", x: person{Age: 70, Income: 20000}, mode: MatchPriority, want: []string{"senior", "rich", "adult"}},
+		{name: "first", x: person{Age: 70, Income: 20000}, mode: MatchFirst, want: []string{"senior"}},
+		{name: "first same priority", x: person{Age: 70, Vip: true}, mode: MatchFirst, want: []string{"senior"}},
+		{name: "first lower priority", x: person{Age: 20, Income: 20000}, mode: MatchFirst, want: []string{"rich"}},
+		{name: "none", x: person{Age: 10}, mode: MatchAll, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Match(tt.x, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := ruleIDs(got); !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Match() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	if !s.SetEnabled("senior", false) {
+		t.Fatal("SetEnabled() = false")
+	}
+	if r, err := s.First(person{Age: 70}); err != nil || r == nil || r.ID != "adult" {
+		t.Errorf("First() = %v, %v, want adult", r, err)
+	}
+	if got, _ := s.WithTag("age").Match(person{Age: 70, Income: 20000}, MatchAll); !reflect.DeepEqual(ruleIDs(got), []string{"adult"}) {
+		t.Errorf("WithTag() Match() = %v, want [adult]", ruleIDs(got))
+	}
+	if !s.Remove("adult") || s.Remove("adult") || s.Len() != 3 {
+		t.Errorf("Remove() failed")
+	}
+	if r, err := s.First(person{Age: 70}); err != nil || r != nil {
+		t.Errorf("First() = %v, %v, want nil", r, err)
+	}
+}
+
+func TestRuleSet_errors(t *testing.T) {
+	s := newTestRuleSet(t)
+	r, _ := NewNamedRule("adult", "age > 20")
+	if err := s.Add(r); !errors.Is(err, ErrDuplicateRule) {
+		t.Errorf("Add() error = %v, want ErrDuplicateRule", err)
+	}
+	a, _ := NewNamedRule("a", "age > 20")
+	b, _ := NewNamedRule("a", "age > 30")
+	if err := s.Add(a, b); !errors.Is(err, ErrDuplicateRule) || s.Len() != 4 {
+		t.Errorf("Add() error = %v, len = %d, want ErrDuplicateRule and nothing added", err, s.Len())
+	}
+	if err := s.Add(&NamedRule{Rule: a.Rule}); !errors.Is(err, ErrRuleID) {
+		t.Errorf("Add() error = %v, want ErrRuleID", err)
+	}
+	if _, err := NewNamedRule("bad", "age >"); err == nil {
+		t.Errorf("NewNamedRule() want error")
+	}
+	_, err := s.Match(map[string]interface{}{"age": 30}, MatchAll)
+	if !errors.Is(err, ErrNotFoundTag) {
+		t.Errorf("Match() error = %v, want ErrNotFoundTag", err)
+	}
+}
@@ -0,0 +1,204 @@
+package gorules
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StoredRule 存储中规则的一个版本，Deleted为true的版本表示规则在这个版本被删除
+type StoredRule struct {
+	ID        string
+	Version   int
+	Def       RuleDef
+	Deleted   bool
+	UpdatedAt time.Time
+}
+
+// RuleStore 规则的持久化存储，每次修改都保存为一个新版本
+type RuleStore interface {
+	// List 所有没有被删除的规则的最新版本，按ID排序
+	List(ctx context.Context) ([]StoredRule, error)
+	// Get 规则的最新版本，规则不存在或已删除时返回ErrNotFoundRule
+	Get(ctx context.Context, id string) (StoredRule, error)
+	// Put 编译检查后保存为规则的新版本
+	Put(ctx context.Context, def RuleDef) (StoredRule, error)
+	// Delete 删除规则，历史版本仍然保留
+	Delete(ctx context.Context, id string) error
+	// History 规则的所有版本，按版本号升序
+	History(ctx context.Context, id string) ([]StoredRule, error)
+}
+
+// LoadStore 编译存储中所有规则的最新版本，启动时和收到规则变更通知时调用
+func LoadStore(ctx context.Context, store RuleStore) (*RuleSet, error) {
+	stored, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := NewRuleSet()
+	for _, sr := range stored {
+		r, err := sr.Def.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("version %d: %w", sr.Version, err)
+		}
+		if err := s.Add(r); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// SQLStore 基于database/sql的RuleStore，规则定义以JSON保存，一行是一个版本：
+//
+//	CREATE TABLE rules (
+//		id         VARCHAR(255) NOT NULL,
+//		version    INTEGER      NOT NULL,
+//		definition TEXT         NOT NULL,
+//		deleted    INTEGER      NOT NULL,
+//		updated_at VARCHAR(64)  NOT NULL,
+//		PRIMARY KEY (id, version)
+//	)
+type SQLStore struct {
+	db *sql.DB
+	// Table 表名，默认为rules
+	Table string
+	// Placeholder 第n个（从1开始）参数的占位符，默认为?，PostgreSQL可以设为"$n"
+	Placeholder func(n int) string
+}
+
+// NewSQLStore 用db保存规则，表名默认为rules，需要时先调用CreateTable建表
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, Table: "rules"}
+}
+
+// CreateTable 表不存在时创建
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.Table+` (
+	id         VARCHAR(255) NOT NULL,
+	version    INTEGER      NOT NULL,
+	definition TEXT         NOT NULL,
+	deleted    INTEGER      NOT NULL,
+	updated_at VARCHAR(64)  NOT NULL,
+	PRIMARY KEY (id, version)
+)`)
+	return err
+}
+
+// query 把查询中的{table}换成表名，?换成Placeholder
+func (s *SQLStore) query(q string) string {
+	q = strings.ReplaceAll(q, "{table}", s.Table)
+	if s.Placeholder == nil {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range q {
+		if c == '?' {
+			n++
+			b.WriteString(s.Placeholder(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+const storeColumns = `id, version, definition, deleted, updated_at`
+
+func (s *SQLStore) List(ctx context.Context) ([]StoredRule, error) {
+	return s.scan(ctx, `SELECT `+storeColumns+` FROM {table} r
+WHERE version = (SELECT MAX(version) FROM {table} WHERE id = r.id) AND deleted = 0 ORDER BY id`)
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (StoredRule, error) {
+	rules, err := s.scan(ctx, `SELECT `+storeColumns+` FROM {table} WHERE id = ? ORDER BY version DESC LIMIT 1`, id)
+	if err != nil {
+		return StoredRule{}, err
+	}
+	if len(rules) == 0 || rules[0].Deleted {
+		return StoredRule{}, fmt.Errorf("%w: %s", ErrNotFoundRule, id)
+	}
+	return rules[0], nil
+}
+
+func (s *SQLStore) History(ctx context.Context, id string) ([]StoredRule, error) {
+	return s.scan(ctx, `SELECT `+storeColumns+` FROM {table} WHERE id = ? ORDER BY version`, id)
+}
+
+func (s *SQLStore) Put(ctx context.Context, def RuleDef) (StoredRule, error) {
+	if _, err := def.Compile(); err != nil {
+		return StoredRule{}, err
+	}
+	return s.insert(ctx, StoredRule{ID: def.ID, Def: def})
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	_, err := s.insert(ctx, StoredRule{ID: id, Def: RuleDef{ID: id}, Deleted: true})
+	return err
+}
+
+// insert 在事务中分配下一个版本号并写入，规则定义的Version与存储的版本号一致。
+// 写入删除标记时在同一个事务中检查规则存在并且没有被删除
+func (s *SQLStore) insert(ctx context.Context, sr StoredRule) (StoredRule, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return StoredRule{}, err
+	}
+	defer tx.Rollback()
+	var last, lastDeleted int
+	err = tx.QueryRowContext(ctx, s.query(`SELECT version, deleted FROM {table} WHERE id = ? ORDER BY version DESC LIMIT 1`), sr.ID).Scan(&last, &lastDeleted)
+	if err != nil && err != sql.ErrNoRows {
+		return StoredRule{}, err
+	}
+	if sr.Deleted && (err == sql.ErrNoRows || lastDeleted != 0) {
+		return StoredRule{}, fmt.Errorf("%w: %s", ErrNotFoundRule, sr.ID)
+	}
+	sr.Version = last + 1
+	sr.Def.Version = sr.Version
+	data, err := json.Marshal(sr.Def)
+	if err != nil {
+		return StoredRule{}, err
+	}
+	sr.UpdatedAt = time.Now().UTC()
+	deleted := 0
+	if sr.Deleted {
+		deleted = 1
+	}
+	if _, err := tx.ExecContext(ctx, s.query(`INSERT INTO {table} (`+storeColumns+`) VALUES (?, ?, ?, ?, ?)`),
+		sr.ID, sr.Version, string(data), deleted, sr.UpdatedAt.Format(time.RFC3339Nano)); err != nil {
+		return StoredRule{}, err
+	}
+	return sr, tx.Commit()
+}
+
+func (s *SQLStore) scan(ctx context.Context, q string, args ...interface{}) ([]StoredRule, error) {
+	rows, err := s.db.QueryContext(ctx, s.query(q), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rules []StoredRule
+	for rows.Next() {
+		var (
+			sr        StoredRule
+			data      string
+			deleted   int
+			updatedAt string
+		)
+		if err := rows.Scan(&sr.ID, &sr.Version, &data, &deleted, &updatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &sr.Def); err != nil {
+			return nil, fmt.Errorf("rule %s version %d: %w", sr.ID, sr.Version, err)
+		}
+		sr.Deleted = deleted != 0
+		if sr.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+			return nil, fmt.Errorf("rule %s version %d: %w", sr.ID, sr.Version, err)
+		}
+		rules = append(rules, sr)
+	}
+	return rules, rows.Err()
+}
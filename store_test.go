@@ -0,0 +1,85 @@
+package gorules
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestStore(t *testing.T) *SQLStore {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "rules.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := NewSQLStore(db)
+	if err := s.CreateTable(context.Background()); err != nil {
+		t.Skip("sqlite unavailable:", err)
+	}
+	return s
+}
+
+func TestSQLStore(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	puts := []RuleDef{
+		{ID: "vip", When: "level >= 3", Priority: 10},
+		{ID: "big", When: "amount > 1000", Tags: []string{"risk"}},
+		{ID: "vip", When: "level >= 4", Priority: 10, Then: map[string]string{"discount": "amount * 0.1"}},
+	}
+	for _, d := range puts {
+		if _, err := s.Put(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Put(ctx, RuleDef{ID: "bad", When: "x >"}); err == nil {
+		t.Error("Put() accepted a rule that does not compile")
+	}
+
+	vip, err := s.Get(ctx, "vip")
+	puts[2].Version = 2
+	if err != nil || vip.Version != 2 || !reflect.DeepEqual(vip.Def, puts[2]) || vip.UpdatedAt.IsZero() {
+		t.Errorf("Get(vip) = %+v, %v", vip, err)
+	}
+	if err := s.Delete(ctx, "big"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "big"); !errors.Is(err, ErrNotFoundRule) {
+		t.Errorf("Get(big) after Delete error = %v", err)
+	}
+	for _, id := range []string{"missing", "big"} {
+		if err := s.Delete(ctx, id); !errors.Is(err, ErrNotFoundRule) {
+			t.Errorf("Delete(%s) error = %v", id, err)
+		}
+	}
+
+	list, err := s.List(ctx)
+	if err != nil || len(list) != 1 || list[0].ID != "vip" || list[0].Version != 2 {
+		t.Errorf("List() = %+v, %v", list, err)
+	}
+	history, err := s.History(ctx, "big")
+	if err != nil || len(history) != 2 || history[0].Deleted || !history[1].Deleted || history[1].Version != 2 {
+		t.Errorf("History(big) = %+v, %v", history, err)
+	}
+
+	set, err := LoadStore(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := set.Get("vip"); !ok || r.Priority != 10 || r.Then["discount"] == nil || set.Len() != 1 {
+		t.Errorf("LoadStore() = %v", set.Rules())
+	}
+}
+
+func TestSQLStore_placeholder(t *testing.T) {
+	s := &SQLStore{Table: "t", Placeholder: func(n int) string { return "$" + string(rune('0'+n)) }}
+	if got, want := s.query("SELECT * FROM {table} WHERE id = ? AND v = ?"), "SELECT * FROM t WHERE id = $1 AND v = $2"; got != want {
+		t.Errorf("query() = %q, want %q", got, want)
+	}
+}
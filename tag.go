@@ -2,6 +2,7 @@ package gorules
 
 import (
 	"reflect"
+	"sync"
 )
 
 const (
@@ -24,3 +25,67 @@ func getTagName(t reflect.StructTag) string {
 	}
 	return name
 }
+
+// typeFields struct类型中tag名到字段下标路径的映射，嵌套struct的字段用“.”连接，
+// 没有tag的匿名字段（embedded）的字段提升到外层，外层同名字段优先
+type typeFields map[string][]int
+
+// fieldCache reflect.Type -> typeFields，多个goroutine共享
+var fieldCache sync.Map
+
+// cachedFields 每个类型只解析一次tag
+func cachedFields(t reflect.Type) typeFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(typeFields)
+	}
+	f := typeFields{}
+	collectFields(f, t, "", nil, map[reflect.Type]bool{})
+	actual, _ := fieldCache.LoadOrStore(t, f)
+	return actual.(typeFields)
+}
+
+func collectFields(fields typeFields, t reflect.Type, prefix string, index []int, visiting map[reflect.Type]bool) {
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := getTagName(field.Tag)
+		if field.Anonymous && name == "" {
+			embedded = append(embedded, field)
+			continue
+		}
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		key := prefix + name
+		if _, ok := fields[key]; ok {
+			continue
+		}
+		path := appendIndex(index, i)
+		fields[key] = path
+		if field.Type.Kind() == reflect.Struct {
+			collectFields(fields, field.Type, key+".", path, visiting)
+		}
+	}
+	for _, field := range embedded {
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			collectFields(fields, ft, prefix, appendIndex(index, field.Index[0]), visiting)
+		}
+	}
+}
+
+func appendIndex(index []int, i int) []int {
+	path := make([]int, len(index)+1)
+	copy(path, index)
+	path[len(index)] = i
+	return path
+}
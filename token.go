@@ -1,24 +1,31 @@
 package gorules
 
 import (
-	"errors"
 	"go/token"
 	"reflect"
 )
 
-func operate(x, y interface{}, tk token.Token) (interface{}, error) {
-	xv := reflect.ValueOf(x)
-	yv := reflect.ValueOf(y)
-	switch tk {
-	case token.ADD, token.SUB, token.MUL, token.QUO:
-		return mathOp(xv, yv, tk)
-	case token.LSS, token.GTR, token.LEQ, token.GEQ, token.EQL, token.NEQ:
-		return compare(xv, yv, tk)
-	case token.LAND, token.LOR:
-		return boolOp(xv, yv, tk)
-	default:
-		return nil, ErrUnsupportToken
-	}
+// 编译期按token选定的数值计算
+var mathFuncs = map[token.Token]func(x, y float64) (float64, error){
+	token.ADD: func(x, y float64) (float64, error) { return x + y, nil },
+	token.SUB: func(x, y float64) (float64, error) { return x - y, nil },
+	token.MUL: func(x, y float64) (float64, error) { return x * y, nil },
+	token.QUO: func(x, y float64) (float64, error) {
+		if y == 0 {
+			return 0, ErrDivZero
+		}
+		return x / y, nil
+	},
+}
+
+// 编译期按token选定的数值比较
+var compareFuncs = map[token.Token]func(x, y float64) bool{
+	token.LSS: func(x, y float64) bool { return x < y },
+	token.GTR: func(x, y float64) bool { return x > y },
+	token.LEQ: func(x, y float64) bool { return x <= y },
+	token.GEQ: func(x, y float64) bool { return x >= y },
+	token.EQL: func(x, y float64) bool { return x == y },
+	token.NEQ: func(x, y float64) bool { return x != y },
 }
 
 // 数字计算操作
@@ -31,21 +38,11 @@ func mathOp(x, y reflect.Value, tk token.Token) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	switch tk {
-	case token.ADD:
-		return numx + numy, nil
-	case token.SUB:
-		return numx - numy, nil
-	case token.MUL:
-		return numx * numy, nil
-	case token.QUO:
-		if numy == 0 {
-			return 0, errors.New("x/0 error")
-		}
-		return numx / numy, nil
-	default:
+	f, ok := mathFuncs[tk]
+	if !ok {
 		return 0, ErrUnsupportToken
 	}
+	return f(numx, numy)
 }
 
 // 数值比较，暂时支持6种 >, <, >=,<=， ==， !=
@@ -61,44 +58,19 @@ func compare(x, y reflect.Value, tk token.Token) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	switch tk {
-	case token.LSS:
-		return numx < numy, nil
-	case token.GTR:
-		return numx > numy, nil
-	case token.LEQ:
-		return numx <= numy, nil
-	case token.GEQ:
-		return numx >= numy, nil
-	case token.EQL:
-		return numx == numy, nil
-	case token.NEQ:
-		return numx != numy, nil
-	default:
-		return false, ErrUnsupportToken
-	}
-}
-
-// 布尔操作 && || 两种
-func boolOp(x, y reflect.Value, tk token.Token) (bool, error) {
-	if x.Kind() != reflect.Bool || y.Kind() != reflect.Bool {
-		return false, ErrNotBool
-	}
-
-	switch tk {
-	case token.LAND:
-		return x.Bool() && y.Bool(), nil
-	case token.LOR:
-		return x.Bool() || y.Bool(), nil
-	default:
+	f, ok := compareFuncs[tk]
+	if !ok {
 		return false, ErrUnsupportToken
 	}
+	return f(numx, numy), nil
 }
 
 func number(x reflect.Value) (float64, error) {
 	switch x.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return float64(x.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(x.Uint()), nil
 	case reflect.Float32, reflect.Float64:
 		return x.Float(), nil
 	default:
@@ -106,6 +78,17 @@ func number(x reflect.Value) (float64, error) {
 	}
 }
 
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
 func compareString(x, y string, tk token.Token) (bool, error) {
 	switch tk {
 	case token.EQL:
@@ -0,0 +1,231 @@
+package gorules
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+var (
+	typeFloat  = reflect.TypeOf(float64(0))
+	typeBool   = reflect.TypeOf(true)
+	typeString = reflect.TypeOf("")
+)
+
+// check 推导表达式的静态类型并记录到cp.types，nil表示运行时才能确定（外部参数、interface字段等）
+func (cp *compiler) check(expr ast.Expr) (reflect.Type, error) {
+	t, err := cp.checkExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	cp.types[expr] = t
+	return t, nil
+}
+
+func (cp *compiler) checkExpr(expr ast.Expr) (reflect.Type, error) {
+	switch t := expr.(type) {
+	case *ast.BinaryExpr:
+		return cp.checkBinary(t)
+	case *ast.Ident:
+		if strings.HasPrefix(t.Name, paramPrefix) {
+			return nil, nil
+		}
+		if i, ok := cp.scope[t.Name]; ok {
+			return cp.letTypes[i], nil
+		}
+		if t.Name == "true" || t.Name == "false" {
+			return typeBool, nil
+		}
+		return fieldType(cp.input, t.Name)
+	case *ast.BasicLit:
+		v, err := parseLit(t)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.TypeOf(v), nil
+	case *ast.ParenExpr:
+		return cp.check(t.X)
+	case *ast.SelectorExpr:
+		xt, err := cp.check(t.X)
+		if err != nil {
+			return nil, err
+		}
+		return fieldType(xt, t.Sel.Name)
+	case *ast.IndexExpr:
+		xt, err := cp.check(t.X)
+		if err != nil {
+			return nil, err
+		}
+		it, err := cp.check(t.Index)
+		if err != nil {
+			return nil, err
+		}
+		if !isNumberType(it) {
+			return nil, fmt.Errorf("%w: index must be number, got %s", ErrTypeMismatch, it)
+		}
+		return elemType(xt)
+	case *ast.CallExpr:
+		return cp.checkCall(t)
+	default:
+		return nil, ErrUnsupportExpr
+	}
+}
+
+func (cp *compiler) checkBinary(t *ast.BinaryExpr) (reflect.Type, error) {
+	xt, err := cp.check(t.X)
+	if err != nil {
+		return nil, err
+	}
+	yt, err := cp.check(t.Y)
+	if err != nil {
+		return nil, err
+	}
+	mismatch := func() error {
+		return fmt.Errorf("%w: %s %s %s", ErrTypeMismatch, typeName(xt), t.Op, typeName(yt))
+	}
+	switch {
+	case t.Op == token.LAND || t.Op == token.LOR:
+		if !isBoolType(xt) || !isBoolType(yt) {
+			return nil, mismatch()
+		}
+		return typeBool, nil
+	case mathFuncs[t.Op] != nil:
+		if !isNumberType(xt) || !isNumberType(yt) {
+			return nil, mismatch()
+		}
+		return typeFloat, nil
+	case compareFuncs[t.Op] != nil:
+		if isStringType(xt) && isStringType(yt) && (xt != nil || yt != nil) {
+			if t.Op != token.EQL && t.Op != token.NEQ {
+				return nil, mismatch()
+			}
+			return typeBool, nil
+		}
+		if !isNumberType(xt) || !isNumberType(yt) {
+			return nil, mismatch()
+		}
+		return typeBool, nil
+	default:
+		return nil, ErrUnsupportToken
+	}
+}
+
+func (cp *compiler) checkCall(t *ast.CallExpr) (reflect.Type, error) {
+	if err := callError(t); err != nil {
+		return nil, err
+	}
+	st, err := cp.check(t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	kt, err := cp.check(t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	et, err := elemType(st)
+	if err != nil {
+		return nil, err
+	}
+	if et == nil || kt == nil {
+		return typeBool, nil
+	}
+	switch {
+	case et.Kind() == reflect.String:
+		if kt.Kind() != reflect.String {
+			return nil, fmt.Errorf("%w: in(%s, %s)", ErrTypeMismatch, st, kt)
+		}
+	case isNumberKind(et.Kind()):
+		if !isNumberKind(kt.Kind()) {
+			return nil, fmt.Errorf("%w: in(%s, %s)", ErrTypeMismatch, st, kt)
+		}
+	default:
+		return nil, errors.New("function IN only support: string int float")
+	}
+	return typeBool, nil
+}
+
+// fieldType 在类型t中查找字段name的类型
+func fieldType(t reflect.Type, name string) (reflect.Type, error) {
+	if t == nil {
+		return nil, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return nil, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("%w: %s", ErrTypeNotStruct, t)
+		}
+		return dynamic(t.Elem()), nil
+	case reflect.Struct:
+		idx, ok := cachedFields(t)[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s in %s", ErrNotFoundTag, name, t)
+		}
+		return dynamic(t.FieldByIndex(idx).Type), nil
+	default:
+		return nil, fmt.Errorf("%w: %s.%s", ErrTypeNotStruct, t, name)
+	}
+}
+
+// fieldIndex 编译时确定struct字段的下标路径
+func fieldIndex(t reflect.Type, name string) ([]int, bool) {
+	if t == nil {
+		return nil, false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	idx, ok := cachedFields(t)[name]
+	return idx, ok
+}
+
+func elemType(t reflect.Type) (reflect.Type, error) {
+	if t == nil {
+		return nil, nil
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return dynamic(t.Elem()), nil
+	case reflect.Interface:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: only slice or array can get value by index, got %s", ErrTypeMismatch, t)
+	}
+}
+
+// dynamic interface类型的值只有运行时才能确定类型
+func dynamic(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Interface {
+		return nil
+	}
+	return t
+}
+
+func isNumberType(t reflect.Type) bool {
+	return t == nil || isNumberKind(t.Kind())
+}
+
+func isBoolType(t reflect.Type) bool {
+	return t == nil || t.Kind() == reflect.Bool
+}
+
+func isStringType(t reflect.Type) bool {
+	return t == nil || t.Kind() == reflect.String
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "any"
+	}
+	return t.String()
+}
@@ -0,0 +1,157 @@
+package gorules
+
+import (
+	"reflect"
+	"sync"
+)
+
+// valueKind 求值过程中值的种类
+type valueKind uint8
+
+const (
+	kindNil valueKind = iota
+	kindBool
+	kindNumber
+	kindString
+	kindRef
+)
+
+// value 求值的中间结果。bool、运算得到的数值、字符串字面量直接保存，
+// 字段值、slice、struct等保存reflect.Value，求值过程中不装箱成interface{}
+type value struct {
+	kind valueKind
+	b    bool
+	num  float64
+	str  string
+	ref  reflect.Value
+}
+
+func boolValue(b bool) value {
+	return value{kind: kindBool, b: b}
+}
+
+func numberValue(f float64) value {
+	return value{kind: kindNumber, num: f}
+}
+
+func stringValue(s string) value {
+	return value{kind: kindString, str: s}
+}
+
+// refValue interface类型的字段取其动态值
+func refValue(v reflect.Value) value {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return value{}
+	}
+	return value{kind: kindRef, ref: v}
+}
+
+// toValue 外部传入的值，如Vars中的参数
+func toValue(x interface{}) value {
+	switch t := x.(type) {
+	case nil:
+		return value{}
+	case bool:
+		return boolValue(t)
+	case float64:
+		return numberValue(t)
+	case string:
+		return stringValue(t)
+	default:
+		return refValue(reflect.ValueOf(x))
+	}
+}
+
+// number 数值或数值类型的字段
+func (v value) number() (float64, error) {
+	switch v.kind {
+	case kindNumber:
+		return v.num, nil
+	case kindRef:
+		return number(v.ref)
+	default:
+		return 0, ErrNotNumber
+	}
+}
+
+// string 字符串或底层类型为string的字段
+func (v value) string() (string, bool) {
+	switch v.kind {
+	case kindString:
+		return v.str, true
+	case kindRef:
+		if v.ref.Kind() == reflect.String {
+			return v.ref.String(), true
+		}
+	}
+	return "", false
+}
+
+// boolean bool或底层类型为bool的字段
+func (v value) boolean() (bool, bool) {
+	switch v.kind {
+	case kindBool:
+		return v.b, true
+	case kindRef:
+		if v.ref.Kind() == reflect.Bool {
+			return v.ref.Bool(), true
+		}
+	}
+	return false, false
+}
+
+// reflect 转换为reflect.Value，用于字段选择、下标等
+func (v value) reflect() reflect.Value {
+	if v.kind == kindRef {
+		return v.ref
+	}
+	return reflect.ValueOf(v.iface())
+}
+
+// iface 转换为interface{}，作为Eval的结果
+func (v value) iface() interface{} {
+	switch v.kind {
+	case kindBool:
+		return v.b
+	case kindNumber:
+		return v.num
+	case kindString:
+		return v.str
+	case kindRef:
+		if v.ref.CanInterface() {
+			return v.ref.Interface()
+		}
+	}
+	return nil
+}
+
+// contextPool 复用evalContext，求值时不分配内存
+var contextPool = sync.Pool{
+	New: func() interface{} { return new(evalContext) },
+}
+
+func getContext(x interface{}) *evalContext {
+	c := contextPool.Get().(*evalContext)
+	c.reset(x)
+	return c
+}
+
+func putContext(c *evalContext) {
+	c.base, c.vars = reflect.Value{}, nil
+	for i := range c.locals {
+		c.locals[i] = value{}
+	}
+	c.locals = c.locals[:0]
+	for i := range c.stack {
+		c.stack[i] = value{}
+	}
+	c.stack = c.stack[:0]
+	for i := range c.memo {
+		c.memo[i] = memoValue{}
+	}
+	c.memo = c.memo[:0]
+	contextPool.Put(c)
+}
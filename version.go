@@ -0,0 +1,221 @@
+package gorules
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeline 同一ID的规则可以有多个版本，求值时间为t时，每个ID选择在t有效的版本中版本号最大的一个。
+// 规则集只在有效期的边界处变化，At按边界缓存选出的规则集
+type Timeline struct {
+	mu       sync.Mutex
+	ids      []string
+	versions map[string][]*NamedRule // 按版本号升序
+	bounds   []time.Time
+	cache    map[int]*RuleSet
+	actions  *RuleSet
+}
+
+// NewTimeline 创建空的版本时间线
+func NewTimeline() *Timeline {
+	return &Timeline{versions: map[string][]*NamedRule{}, cache: map[int]*RuleSet{}, actions: NewRuleSet()}
+}
+
+// Add 加入规则的一个版本，同一ID的版本号不能重复
+func (t *Timeline) Add(r *NamedRule) error {
+	if r.ID == "" {
+		return ErrRuleID
+	}
+	if r.Rule == nil {
+		return fmt.Errorf("rule %s: %w", r.ID, ErrRuleEmpty)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	vs := t.versions[r.ID]
+	i := sort.Search(len(vs), func(i int) bool { return vs[i].Version >= r.Version })
+	if i < len(vs) && vs[i].Version == r.Version {
+		return fmt.Errorf("%w: %s version %d", ErrDuplicateRule, r.ID, r.Version)
+	}
+	if len(vs) == 0 {
+		t.ids = append(t.ids, r.ID)
+	}
+	vs = append(vs, nil)
+	copy(vs[i+1:], vs[i:])
+	vs[i] = r
+	t.versions[r.ID] = vs
+	for _, b := range []time.Time{r.EffectiveFrom, r.EffectiveTo} {
+		if !b.IsZero() {
+			t.bounds = append(t.bounds, b)
+		}
+	}
+	sort.Slice(t.bounds, func(i, j int) bool { return t.bounds[i].Before(t.bounds[j]) })
+	t.cache = map[int]*RuleSet{}
+	return nil
+}
+
+// Versions 规则的所有版本，按版本号升序
+func (t *Timeline) Versions(id string) []*NamedRule {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*NamedRule(nil), t.versions[id]...)
+}
+
+// SetAction 注册回调，At返回的规则集都使用这些回调
+func (t *Timeline) SetAction(name string, fn Action) {
+	t.actions.SetAction(name, fn)
+	t.mu.Lock()
+	t.cache = map[int]*RuleSet{}
+	t.mu.Unlock()
+}
+
+// At 时间at生效的规则集，规则按ID第一次加入的顺序排列，返回的规则集不要修改
+func (t *Timeline) At(at time.Time) *RuleSet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// 落在同一对相邻边界之间的时间选出的版本相同
+	span := sort.Search(len(t.bounds), func(i int) bool { return t.bounds[i].After(at) })
+	if s, ok := t.cache[span]; ok {
+		return s
+	}
+	s := NewRuleSet()
+	s.copyActions(t.actions)
+	for _, id := range t.ids {
+		vs := t.versions[id]
+		for i := len(vs) - 1; i >= 0; i-- {
+			if vs[i].ActiveAt(at) {
+				s.Add(vs[i])
+				break
+			}
+		}
+	}
+	t.cache[span] = s
+	return s
+}
+
+// Match 用时间at生效的规则版本匹配x
+func (t *Timeline) Match(x interface{}, mode MatchMode, at time.Time) ([]*NamedRule, error) {
+	return t.At(at).MatchAt(x, mode, at)
+}
+
+// LoadTimeline 编译存储中所有没有被删除的规则的全部版本
+func LoadTimeline(ctx context.Context, store RuleStore) (*Timeline, error) {
+	latest, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := NewTimeline()
+	for _, l := range latest {
+		history, err := store.History(ctx, l.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, sr := range history {
+			if sr.Deleted {
+				continue
+			}
+			r, err := sr.Def.Compile()
+			if err != nil {
+				return nil, fmt.Errorf("version %d: %w", sr.Version, err)
+			}
+			if err := t.Add(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// Change 两个规则定义之间一个字段的差异，Then中的键写作then.key，值为空表示没有该字段
+type Change struct {
+	Field string
+	Old   string
+	New   string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New)
+}
+
+// DiffDefs 比较两个规则定义，不比较ID和Version，按字段顺序返回差异
+func DiffDefs(a, b RuleDef) []Change {
+	var changes []Change
+	diff := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, Change{Field: field, Old: old, New: new})
+		}
+	}
+	diff("description", a.Description, b.Description)
+	if !reflect.DeepEqual(a.Tags, b.Tags) {
+		changes = append(changes, Change{Field: "tags", Old: strings.Join(a.Tags, ","), New: strings.Join(b.Tags, ",")})
+	}
+	diff("priority", strconv.Itoa(a.Priority), strconv.Itoa(b.Priority))
+	diff("disabled", strconv.FormatBool(a.Disabled), strconv.FormatBool(b.Disabled))
+	diff("when", a.When, b.When)
+	diff("value", a.Value, b.Value)
+	keys := make([]string, 0, len(a.Then)+len(b.Then))
+	for k := range a.Then {
+		keys = append(keys, k)
+	}
+	for k := range b.Then {
+		if _, ok := a.Then[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		diff("then."+k, a.Then[k], b.Then[k])
+	}
+	diff("action", a.Action, b.Action)
+	diff("effective_from", formatTime(a.EffectiveFrom), formatTime(b.EffectiveFrom))
+	diff("effective_to", formatTime(a.EffectiveTo), formatTime(b.EffectiveTo))
+	return changes
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// DiffVersions 比较存储中规则的两个版本
+func DiffVersions(ctx context.Context, store RuleStore, id string, from, to int) ([]Change, error) {
+	a, err := storedVersion(ctx, store, id, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := storedVersion(ctx, store, id, to)
+	if err != nil {
+		return nil, err
+	}
+	return DiffDefs(a.Def, b.Def), nil
+}
+
+// Rollback 把规则的一个历史版本保存为新版本，历史记录保持不变
+func Rollback(ctx context.Context, store RuleStore, id string, version int) (StoredRule, error) {
+	sr, err := storedVersion(ctx, store, id, version)
+	if err != nil {
+		return StoredRule{}, err
+	}
+	return store.Put(ctx, sr.Def)
+}
+
+// storedVersion 规则的一个没有被删除的版本
+func storedVersion(ctx context.Context, store RuleStore, id string, version int) (StoredRule, error) {
+	history, err := store.History(ctx, id)
+	if err != nil {
+		return StoredRule{}, err
+	}
+	for _, sr := range history {
+		if sr.Version == version && !sr.Deleted {
+			return sr, nil
+		}
+	}
+	return StoredRule{}, fmt.Errorf("%w: %s version %d", ErrNotFoundRule, id, version)
+}
@@ -0,0 +1,115 @@
+package gorules
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeline_At(t *testing.T) {
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	jul := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	defs := []RuleDef{
+		{ID: "tax", Version: 1, When: "amount > 100"},
+		{ID: "tax", Version: 2, When: "amount > 200", EffectiveFrom: &jan},
+		{ID: "tax", Version: 3, When: "amount > 300", EffectiveFrom: &jul},
+		{ID: "promo", Version: 1, When: "amount > 0", EffectiveFrom: &jan, EffectiveTo: &jul},
+	}
+	tl := NewTimeline()
+	for _, d := range defs {
+		r, err := d.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tl.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tl.Add(&NamedRule{ID: "tax", Version: 2, Rule: tl.Versions("tax")[0].Rule}); !errors.Is(err, ErrDuplicateRule) {
+		t.Errorf("Add() duplicate version error = %v", err)
+	}
+	tests := []struct {
+		at   time.Time
+		want map[string]int
+	}{
+		{at: jan.Add(-time.Second), want: map[string]int{"tax": 1}},
+		{at: jan, want: map[string]int{"tax": 2, "promo": 1}},
+		{at: jul.Add(-time.Second), want: map[string]int{"tax": 2, "promo": 1}},
+		{at: jul, want: map[string]int{"tax": 3}},
+	}
+	for _, tt := range tests {
+		got := map[string]int{}
+		for _, r := range tl.At(tt.at).Rules() {
+			got[r.ID] = r.Version
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("At(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+	if tl.At(jan) != tl.At(jan.Add(time.Hour)) {
+		t.Error("At() should reuse the rule set between two bounds")
+	}
+	matched, err := tl.Match(map[string]interface{}{"amount": 250}, MatchAll, jan)
+	if err != nil || len(matched) != 2 || matched[0].Version != 2 {
+		t.Errorf("Match() = %v, %v", matched, err)
+	}
+}
+
+func TestRuleSet_MatchAt(t *testing.T) {
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r, err := RuleDef{ID: "old", When: "true", EffectiveTo: &jan}.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewRuleSet()
+	s.Add(r)
+	if matched, _ := s.MatchAt(nil, MatchAll, jan.Add(-time.Hour)); len(matched) != 1 {
+		t.Errorf("MatchAt() before effective_to = %v", matched)
+	}
+	if matched, _ := s.Match(nil, MatchAll); len(matched) != 0 {
+		t.Errorf("Match() after effective_to = %v", matched)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Put(ctx, RuleDef{ID: "tax", When: "amount > 100", Then: map[string]string{"rate": "0.1"}})
+	s.Put(ctx, RuleDef{ID: "tax", When: "amount > 200", Then: map[string]string{"rate": "0.2", "note": `"new"`}, EffectiveFrom: &jan})
+
+	changes, err := DiffVersions(ctx, s, "tax", 1, 2)
+	want := []Change{
+		{Field: "when", Old: "amount > 100", New: "amount > 200"},
+		{Field: "then.note", New: `"new"`},
+		{Field: "then.rate", Old: "0.1", New: "0.2"},
+		{Field: "effective_from", New: "2024-01-01T00:00:00Z"},
+	}
+	if err != nil || !reflect.DeepEqual(changes, want) {
+		t.Errorf("DiffVersions() = %v, %v, want %v", changes, err, want)
+	}
+	if _, err := DiffVersions(ctx, s, "tax", 1, 9); !errors.Is(err, ErrNotFoundRule) {
+		t.Errorf("DiffVersions() missing version error = %v", err)
+	}
+
+	sr, err := Rollback(ctx, s, "tax", 1)
+	if err != nil || sr.Version != 3 || sr.Def.When != "amount > 100" {
+		t.Fatalf("Rollback() = %+v, %v", sr, err)
+	}
+	if changes, _ := DiffVersions(ctx, s, "tax", 1, 3); len(changes) != 0 {
+		t.Errorf("rolled back version differs: %v", changes)
+	}
+
+	tl, err := LoadTimeline(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs := tl.Versions("tax"); len(vs) != 3 {
+		t.Fatalf("Versions() = %v", vs)
+	}
+	if r, _ := tl.At(jan.AddDate(1, 0, 0)).Get("tax"); r.Version != 3 {
+		t.Errorf("At() selected version %d, want the rollback version 3", r.Version)
+	}
+}
@@ -0,0 +1,571 @@
+package gorules
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// opcode 字节码指令，arg的含义见各指令的注释
+type opcode uint8
+
+const (
+	opConst    opcode = iota // 压入常量consts[arg]
+	opField                  // 从输入对象取字段names[arg]，可以是a.b.c形式的路径
+	opVar                    // 压入外部参数names[arg]
+	opLocal                  // 压入let变量locals[arg]
+	opStore                  // 弹出栈顶保存为let变量locals[arg]
+	opSelect                 // 弹出x，压入x的字段names[arg]
+	opIndex                  // 弹出x、下标，压入x[下标]
+	opIndexKey               // 栈顶作为下标必须是数值，在计算x之前检查
+	opIn                     // 弹出key、slice，压入IN(slice, key)
+	opAdd                    // 弹出y、x，压入x+y，以下运算、比较指令相同
+	opSub
+	opMul
+	opQuo
+	opLss
+	opGtr
+	opLeq
+	opGeq
+	opEql
+	opNeq
+	opAnd // 弹出y、x，两者都必须是bool，压入x&&y
+	opOr  // 弹出y、x，两者都必须是bool，压入x||y
+	opCount
+)
+
+// instr 一条指令
+type instr struct {
+	op  opcode
+	arg int
+}
+
+// opStack 每条指令弹出、压入的操作数个数
+var opStack = [opCount][2]int{
+	opConst: {0, 1}, opField: {0, 1}, opVar: {0, 1}, opLocal: {0, 1}, opStore: {1, 0},
+	opSelect: {1, 1}, opIndex: {2, 1}, opIndexKey: {1, 1}, opIn: {2, 1},
+	opAdd: {2, 1}, opSub: {2, 1}, opMul: {2, 1}, opQuo: {2, 1},
+	opLss: {2, 1}, opGtr: {2, 1}, opLeq: {2, 1}, opGeq: {2, 1}, opEql: {2, 1}, opNeq: {2, 1},
+	opAnd: {2, 1}, opOr: {2, 1},
+}
+
+// 二元运算符对应的指令
+var binaryOps = map[token.Token]opcode{
+	token.ADD: opAdd, token.SUB: opSub, token.MUL: opMul, token.QUO: opQuo,
+	token.LSS: opLss, token.GTR: opGtr, token.LEQ: opLeq, token.GEQ: opGeq, token.EQL: opEql, token.NEQ: opNeq,
+	token.LAND: opAnd, token.LOR: opOr,
+}
+
+// 按指令下标查找运算符和计算函数，执行时不查map
+var (
+	opTokens  [opCount]token.Token
+	opMath    [opCount]func(x, y float64) (float64, error)
+	opCompare [opCount]func(x, y float64) bool
+)
+
+func init() {
+	for tok, op := range binaryOps {
+		opTokens[op], opMath[op], opCompare[op] = tok, mathFuncs[tok], compareFuncs[tok]
+	}
+}
+
+// Program 编译为字节码的规则，由一个小的栈式虚拟机执行，语义与NewRule得到的规则相同。
+// Program可以用MarshalBinary序列化后缓存，UnmarshalBinary加载时校验每条指令
+type Program struct {
+	// Limit 每次求值最多执行的指令数，超过时返回ErrStepLimit，0表示不限制，不参与序列化
+	Limit int
+
+	code     []instr
+	consts   []value
+	names    []string
+	paths    [][]string
+	locals   int
+	warnings []string
+}
+
+// NewProgram 把规则编译为字节码，规则的写法与NewRule相同，常量在编译时折叠，
+// NewRule求值时才报错的函数、运算符在这里直接返回错误
+func NewProgram(r string) (*Program, error) {
+	ru, err := newRule(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	e := &emitter{
+		p:     &Program{locals: len(ru.lets), warnings: ru.warnings},
+		cp:    &compiler{scope: scope{}, consts: ru.consts},
+		names: map[string]int{},
+	}
+	for i, l := range ru.lets {
+		if err := e.emit(l.expr); err != nil {
+			return nil, err
+		}
+		e.op(opStore, i)
+		e.cp.scope[l.name] = i
+	}
+	if err := e.emit(ru.expr); err != nil {
+		return nil, err
+	}
+	if err := e.p.verify(); err != nil {
+		return nil, err
+	}
+	e.p.prepare()
+	return e.p, nil
+}
+
+// emitter 从ast生成指令，cp提供作用域和编译时折叠出的常量
+type emitter struct {
+	p     *Program
+	cp    *compiler
+	names map[string]int
+}
+
+func (e *emitter) op(op opcode, arg int) int {
+	e.p.code = append(e.p.code, instr{op, arg})
+	return len(e.p.code) - 1
+}
+
+func (e *emitter) name(s string) int {
+	i, ok := e.names[s]
+	if !ok {
+		i = len(e.p.names)
+		e.names[s] = i
+		e.p.names = append(e.p.names, s)
+	}
+	return i
+}
+
+func (e *emitter) constant(v value) int {
+	for i, c := range e.p.consts {
+		if c.kind == v.kind && c.kind != kindRef && c.b == v.b && c.num == v.num && c.str == v.str {
+			return i
+		}
+	}
+	e.p.consts = append(e.p.consts, v)
+	return len(e.p.consts) - 1
+}
+
+// emit 按闭包的求值顺序生成指令
+func (e *emitter) emit(expr ast.Expr) error {
+	if v, ok := e.cp.consts[expr]; ok {
+		e.op(opConst, e.constant(v))
+		return nil
+	}
+	switch t := expr.(type) {
+	case *ast.ParenExpr:
+		return e.emit(t.X)
+	case *ast.Ident:
+		if strings.HasPrefix(t.Name, paramPrefix) {
+			e.op(opVar, e.name(t.Name[len(paramPrefix):]))
+		} else if i, ok := e.cp.scope[t.Name]; ok {
+			e.op(opLocal, i)
+		} else {
+			e.op(opField, e.name(t.Name))
+		}
+	case *ast.SelectorExpr:
+		if path, ok := e.cp.fieldPath(t); ok {
+			e.op(opField, e.name(path))
+			return nil
+		}
+		if err := e.emit(t.X); err != nil {
+			return err
+		}
+		e.op(opSelect, e.name(t.Sel.Name))
+	case *ast.IndexExpr:
+		if err := e.emit(t.Index); err != nil {
+			return err
+		}
+		e.op(opIndexKey, 0)
+		if err := e.emit(t.X); err != nil {
+			return err
+		}
+		e.op(opIndex, 0)
+	case *ast.CallExpr:
+		if err := callError(t); err != nil {
+			return err
+		}
+		for _, a := range t.Args {
+			if err := e.emit(a); err != nil {
+				return err
+			}
+		}
+		e.op(opIn, 0)
+	case *ast.BinaryExpr:
+		if err := e.emit(t.X); err != nil {
+			return err
+		}
+		if err := e.emit(t.Y); err != nil {
+			return err
+		}
+		op, ok := binaryOps[t.Op]
+		if !ok {
+			return ErrUnsupportToken
+		}
+		e.op(op, 0)
+	default:
+		return ErrUnsupportExpr
+	}
+	return nil
+}
+
+// prepare 预先拆分字段路径，求值时不再分配
+func (p *Program) prepare() {
+	p.paths = make([][]string, len(p.names))
+	for i, n := range p.names {
+		p.paths[i] = strings.Split(n, ".")
+	}
+}
+
+// run 执行指令，加载时已校验过栈深度和参数范围，执行时不再检查
+func (p *Program) run(c *evalContext) (value, error) {
+	for len(c.locals) < p.locals {
+		c.locals = append(c.locals, value{})
+	}
+	stack := c.stack[:0]
+	var err error
+	for pc, steps := 0, 0; pc < len(p.code) && err == nil; pc++ {
+		if steps++; p.Limit > 0 && steps > p.Limit {
+			err = ErrStepLimit
+			break
+		}
+		in, n := p.code[pc], len(stack)
+		switch in.op {
+		case opConst:
+			stack = append(stack, p.consts[in.arg])
+		case opField:
+			var v value
+			v, err = p.field(c, in.arg)
+			stack = append(stack, v)
+		case opVar:
+			var v value
+			v, err = c.getVar(p.names[in.arg])
+			stack = append(stack, v)
+		case opLocal:
+			stack = append(stack, c.locals[in.arg])
+		case opStore:
+			c.locals[in.arg] = stack[n-1]
+			stack = stack[:n-1]
+		case opSelect:
+			stack[n-1], err = lookupField(stack[n-1].reflect(), p.names[in.arg])
+		case opIndex:
+			stack[n-2], err = indexValue(stack[n-1], stack[n-2])
+			stack = stack[:n-1]
+		case opIndexKey:
+			if _, e := stack[n-1].number(); e != nil {
+				err = ErrIndexNotNumber
+			}
+		case opIn:
+			var b bool
+			b, err = isIn(stack[n-2], stack[n-1])
+			stack[n-2] = boolValue(b)
+			stack = stack[:n-1]
+		case opAdd, opSub, opMul, opQuo:
+			var x, y, r float64
+			if x, y, err = numbers(stack[n-2], stack[n-1]); err == nil {
+				r, err = opMath[in.op](x, y)
+			}
+			stack[n-2] = numberValue(r)
+			stack = stack[:n-1]
+		case opLss, opGtr, opLeq, opGeq, opEql, opNeq:
+			stack[n-2], err = compareValues(stack[n-2], stack[n-1], opTokens[in.op], opCompare[in.op])
+			stack = stack[:n-1]
+		case opAnd, opOr:
+			x, xok := stack[n-2].boolean()
+			y, yok := stack[n-1].boolean()
+			if !xok || !yok {
+				err = ErrNotBool
+			}
+			b := x && y
+			if in.op == opOr {
+				b = x || y
+			}
+			stack[n-2] = boolValue(b)
+			stack = stack[:n-1]
+		}
+	}
+	c.stack = stack
+	if err != nil {
+		return value{}, err
+	}
+	return stack[len(stack)-1], nil
+}
+
+// field 输入对象是struct且路径在缓存中时按下标取值，否则逐级取值
+func (p *Program) field(c *evalContext, i int) (value, error) {
+	if c.base.Kind() == reflect.Struct {
+		if idx, ok := cachedFields(c.base.Type())[p.names[i]]; ok {
+			return fieldByIndex(c.base, idx)
+		}
+	}
+	path := p.paths[i]
+	v, err := lookupField(c.base, path[0])
+	for _, name := range path[1:] {
+		if err != nil {
+			break
+		}
+		v, err = lookupField(v.reflect(), name)
+	}
+	return v, err
+}
+
+func (p *Program) evalValue(x interface{}) (value, error) {
+	if len(p.code) == 0 {
+		return value{}, ErrInvalidProgram
+	}
+	c := getContext(x)
+	defer putContext(c)
+	return p.run(c)
+}
+
+// Eval x可以是规则字段所在的对象，也可以是携带外部参数的Env
+func (p *Program) Eval(x interface{}) (interface{}, error) {
+	v, err := p.evalValue(x)
+	if err != nil {
+		return nil, err
+	}
+	return v.iface(), nil
+}
+
+func (p *Program) Bool(x interface{}) (bool, error) {
+	return boolResult(p.evalValue(x))
+}
+
+func (p *Program) Int(x interface{}) (int64, error) {
+	return intResult(p.evalValue(x))
+}
+
+func (p *Program) Float(x interface{}) (float64, error) {
+	return floatResult(p.evalValue(x))
+}
+
+func (p *Program) String(x interface{}) (string, error) {
+	return stringResult(p.evalValue(x))
+}
+
+func (p *Program) Strings(x interface{}) ([]string, error) {
+	return stringsResult(p.Eval(x))
+}
+
+func (p *Program) Warnings() []string {
+	return p.warnings
+}
+
+// 字节码的序列化格式：魔数、版本号，之后依次是let变量个数、常量、名字、指令、警告，
+// 整数都用uvarint编码
+const (
+	programMagic   = "GRVM"
+	programVersion = 2
+)
+
+// MarshalBinary 序列化字节码，用于缓存编译结果
+func (p *Program) MarshalBinary() ([]byte, error) {
+	var w programWriter
+	w.buf.WriteString(programMagic)
+	w.buf.WriteByte(programVersion)
+	w.uint(p.locals)
+	w.uint(len(p.consts))
+	for _, v := range p.consts {
+		w.buf.WriteByte(byte(v.kind))
+		switch v.kind {
+		case kindBool:
+			if v.b {
+				w.uint(1)
+			} else {
+				w.uint(0)
+			}
+		case kindNumber:
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(v.num))
+			w.buf.Write(b[:])
+		case kindString:
+			w.string(v.str)
+		case kindRef:
+			// 只有整数字面量以原类型保存
+			if v.ref.Kind() != reflect.Int64 {
+				return nil, fmt.Errorf("%w: constant of type %s", ErrInvalidProgram, v.ref.Type())
+			}
+			var b [binary.MaxVarintLen64]byte
+			w.buf.Write(b[:binary.PutVarint(b[:], v.ref.Int())])
+		}
+	}
+	w.strings(p.names)
+	w.uint(len(p.code))
+	for _, in := range p.code {
+		w.buf.WriteByte(byte(in.op))
+		w.uint(in.arg)
+	}
+	w.strings(p.warnings)
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary 加载MarshalBinary的结果，格式错误或指令不合法时返回ErrInvalidProgram
+func (p *Program) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(programMagic)) {
+		return fmt.Errorf("%w: bad magic", ErrInvalidProgram)
+	}
+	r := programReader{r: bytes.NewReader(data[len(programMagic):])}
+	if v, err := r.r.ReadByte(); err != nil || v != programVersion {
+		return fmt.Errorf("%w: unsupported version", ErrInvalidProgram)
+	}
+	q := &Program{Limit: p.Limit, locals: r.uint()}
+	q.consts = make([]value, r.count())
+	for i := range q.consts {
+		switch kind, _ := r.r.ReadByte(); valueKind(kind) {
+		case kindNil:
+		case kindBool:
+			q.consts[i] = boolValue(r.uint() == 1)
+		case kindNumber:
+			var b [8]byte
+			if _, err := io.ReadFull(r.r, b[:]); err != nil {
+				r.fail(err)
+			}
+			q.consts[i] = numberValue(math.Float64frombits(binary.LittleEndian.Uint64(b[:])))
+		case kindString:
+			q.consts[i] = stringValue(r.string())
+		case kindRef:
+			n, err := binary.ReadVarint(r.r)
+			if err != nil {
+				r.fail(err)
+			}
+			q.consts[i] = refValue(reflect.ValueOf(n))
+		default:
+			r.fail(fmt.Errorf("unknown constant kind %d", kind))
+		}
+	}
+	q.names = r.strings()
+	q.code = make([]instr, r.count())
+	for i := range q.code {
+		op, _ := r.r.ReadByte()
+		q.code[i] = instr{opcode(op), r.uint()}
+	}
+	q.warnings = r.strings()
+	if r.err == nil && r.r.Len() > 0 {
+		r.fail(fmt.Errorf("%d trailing bytes", r.r.Len()))
+	}
+	if r.err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProgram, r.err)
+	}
+	if err := q.verify(); err != nil {
+		return err
+	}
+	q.prepare()
+	*p = *q
+	return nil
+}
+
+// verify 校验指令和参数范围，并模拟栈深度：每条指令的操作数都在栈上，
+// 最后栈上恰好剩下结果
+func (p *Program) verify() error {
+	invalid := func(pc int, msg string) error {
+		return fmt.Errorf("%w: instruction %d: %s", ErrInvalidProgram, pc, msg)
+	}
+	if len(p.code) == 0 {
+		return fmt.Errorf("%w: empty program", ErrInvalidProgram)
+	}
+	if p.locals > len(p.code) {
+		return fmt.Errorf("%w: too many locals", ErrInvalidProgram)
+	}
+	d := 0
+	for pc, in := range p.code {
+		if in.op >= opCount {
+			return invalid(pc, "unknown opcode")
+		}
+		limit := 1
+		switch in.op {
+		case opConst:
+			limit = len(p.consts)
+		case opField, opVar, opSelect:
+			limit = len(p.names)
+		case opLocal, opStore:
+			limit = p.locals
+		}
+		if in.arg < 0 || in.arg >= limit {
+			return invalid(pc, "argument out of range")
+		}
+		if d < opStack[in.op][0] {
+			return invalid(pc, "stack underflow")
+		}
+		d += opStack[in.op][1] - opStack[in.op][0]
+	}
+	if d != 1 {
+		return invalid(len(p.code), "program must leave one result")
+	}
+	return nil
+}
+
+type programWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *programWriter) uint(n int) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+func (w *programWriter) string(s string) {
+	w.uint(len(s))
+	w.buf.WriteString(s)
+}
+
+func (w *programWriter) strings(s []string) {
+	w.uint(len(s))
+	for _, v := range s {
+		w.string(v)
+	}
+}
+
+// programReader 读取出错后记录第一个错误，之后的读取都返回零值
+type programReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (r *programReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *programReader) uint() int {
+	if r.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil || n > math.MaxInt32 {
+		r.fail(fmt.Errorf("bad integer"))
+		return 0
+	}
+	return int(n)
+}
+
+// count 元素个数，每个元素至少占一个字节，超过剩余字节数时数据一定不完整
+func (r *programReader) count() int {
+	n := r.uint()
+	if n > r.r.Len() {
+		r.fail(fmt.Errorf("bad length %d", n))
+		return 0
+	}
+	return n
+}
+
+func (r *programReader) string() string {
+	n := r.count()
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.fail(err)
+	}
+	return string(b)
+}
+
+func (r *programReader) strings() []string {
+	s := make([]string, r.count())
+	for i := range s {
+		s[i] = r.string()
+	}
+	return s
+}
@@ -0,0 +1,168 @@
+package gorules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestProgram_sameAsRule(t *testing.T) {
+	type user struct {
+		Age  int64  `json:"age"`
+		Name string `json:"name"`
+		Vip  bool   `json:"vip"`
+	}
+	e := &example{A: 12, B: 25, C: "xxx", Xyz: xyz{X: []int64{3, 18}, Y: []float64{1.5}, Z: []string{"xxx"}}}
+	inputs := []interface{}{
+		e,
+		Env{Input: e, Vars: Vars{"limit": 30, "name": "xxx", "list": []string{"a", "xxx"}}},
+		Roots{"user": &user{Age: 20, Name: "bob", Vip: true}, "ext": map[string]interface{}{"level": "gold"}},
+		Roots{"user": (*user)(nil)},
+		evalType{A: 3, B: 1.5, C: "abc", D: []string{"x", "y"}, E: []int64{7}},
+	}
+	rules := []string{
+		"a+b>xyz.x[1] && in(xyz.z,c) && xyz.y[0]<a*b",
+		"a+b > $limit || c == $name",
+		"in($list, c) && vip",
+		"let s = a+b; let t = s*2; t - s",
+		"let a = 1; a + b",
+		"xyz.x[a/12]",
+		"xyz.x[c]",
+		"xyz.x[5]",
+		"a / (b - 25)",
+		"c",
+		`c > "aaa"`,
+		"a > 100 && missing > 1",
+		"a < 100 || missing > 1",
+		"a && b",
+		"a > 1 && b",
+		"(1 + 2) * a",
+		"true && a > 1",
+		"a > 1 && true",
+		"a > 1 || true",
+		"a > 1 / (2 - 2)",
+		"1 && a > 1",
+		"user.age >= 18 && user.vip && ext.level == \"gold\"",
+		"user.name",
+		"$missing",
+		"d",
+		"e[0]",
+		"f.z",
+	}
+	for _, src := range rules {
+		r, rerr := NewRule(src)
+		p, perr := NewProgram(src)
+		if (rerr != nil) != (perr != nil) {
+			t.Fatalf("%s NewRule() error = %v, NewProgram() error = %v", src, rerr, perr)
+		}
+		if rerr != nil {
+			continue
+		}
+		if !reflect.DeepEqual(r.Warnings(), p.Warnings()) {
+			t.Errorf("%s Warnings() = %v, want %v", src, p.Warnings(), r.Warnings())
+		}
+		for _, x := range inputs {
+			want, werr := r.Eval(x)
+			got, err := p.Eval(x)
+			if (werr != nil) != (err != nil) || (err != nil && err.Error() != werr.Error()) {
+				t.Errorf("%s Eval(%v) error = %v, want %v", src, x, err, werr)
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s Eval(%v) = %#v, want %#v", src, x, got, want)
+			}
+		}
+	}
+}
+
+func TestNewProgram_error(t *testing.T) {
+	for _, src := range []string{"notin(xs, a)", "foo(xs, a)", "max(a, b)", "in(a)", "IN(a, b, c)", "a.in(b, c)", "a & b", "-a"} {
+		if _, err := NewProgram(src); err == nil {
+			t.Errorf("NewProgram(%q) want error", src)
+		}
+	}
+	p, err := NewProgram("IN(xyz.z, c)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := p.Bool(&example{C: "x", Xyz: xyz{Z: []string{"x"}}}); err != nil || !got {
+		t.Errorf("Bool() = %v, %v, want true", got, err)
+	}
+}
+
+func TestProgram_marshal(t *testing.T) {
+	e := &example{A: 12, B: 25, C: "xxx", Xyz: xyz{X: []int64{3, 18}, Z: []string{"xxx"}}}
+	src := `let s = a + b; s > xyz.x[1] && in(xyz.z, c) && c != "a;b" && 2.5 < 3 || $flag`
+	p, err := NewProgram(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q Program
+	if err := q.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := q.Bool(Env{Input: e, Vars: Vars{"flag": false}}); err != nil || !got {
+		t.Errorf("Bool() = %v, %v, want true", got, err)
+	}
+	if !reflect.DeepEqual(q.code, p.code) || !reflect.DeepEqual(q.names, p.names) || q.locals != p.locals {
+		t.Errorf("UnmarshalBinary() program differs")
+	}
+	if again, _ := q.MarshalBinary(); !reflect.DeepEqual(again, data) {
+		t.Errorf("MarshalBinary() not stable")
+	}
+
+	// 截断、篡改的数据都不能加载
+	for i := 0; i < len(data); i++ {
+		if err := new(Program).UnmarshalBinary(data[:i]); !errors.Is(err, ErrInvalidProgram) {
+			t.Fatalf("UnmarshalBinary(data[:%d]) error = %v, want ErrInvalidProgram", i, err)
+		}
+	}
+	bad := []*Program{
+		{code: []instr{{opAdd, 0}}},
+		{code: []instr{{opConst, 1}}, consts: []value{boolValue(true)}},
+		{code: []instr{{opConst, 0}, {opAnd, 0}}, consts: []value{boolValue(true)}},
+		{code: []instr{{opConst, 0}, {opConst, 0}}, consts: []value{boolValue(true)}},
+		{code: []instr{{opCount, 0}}},
+		{},
+	}
+	for i, b := range bad {
+		data, err := b.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := new(Program).UnmarshalBinary(data); !errors.Is(err, ErrInvalidProgram) {
+			t.Errorf("bad program %d UnmarshalBinary() error = %v, want ErrInvalidProgram", i, err)
+		}
+	}
+	if _, err := new(Program).Bool(e); !errors.Is(err, ErrInvalidProgram) {
+		t.Errorf("empty Program Bool() error = %v, want ErrInvalidProgram", err)
+	}
+}
+
+func TestProgram_limit(t *testing.T) {
+	e := &example{A: 12, B: 25}
+	p, err := NewProgram("a > 1 && b > 1 && a + b > 30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Limit = 5
+	if _, err := p.Bool(e); !errors.Is(err, ErrStepLimit) {
+		t.Errorf("Bool() error = %v, want ErrStepLimit", err)
+	}
+	p.Limit = len(p.code)
+	if got, err := p.Bool(e); err != nil || !got {
+		t.Errorf("Bool() = %v, %v, want true", got, err)
+	}
+	// 两侧都要计算，左侧为false时执行的指令数不变
+	if got, err := p.Bool(&example{A: 0}); err != nil || got {
+		t.Errorf("Bool() = %v, %v, want false", got, err)
+	}
+	p.Limit = len(p.code) - 1
+	if _, err := p.Bool(&example{A: 0}); !errors.Is(err, ErrStepLimit) {
+		t.Errorf("Bool() error = %v, want ErrStepLimit", err)
+	}
+}
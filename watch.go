@@ -0,0 +1,154 @@
+package gorules
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultWatchInterval Watcher默认的轮询间隔
+const defaultWatchInterval = 2 * time.Second
+
+// ReloadEvent 一次重新加载的结果，Err不为nil时Rules为nil，Watcher继续使用之前的规则集
+type ReloadEvent struct {
+	Time  time.Time
+	Files []string
+	Rules *RuleSet
+	Err   error
+}
+
+// Watcher 轮询目录中的规则文件，文件内容变化时用LoadRuleDir重新加载，
+// 新规则集完整编译成功后才原子地替换当前规则集，编译失败时保留最后一次成功的规则集。
+// 变化后的内容要在连续两次检查中相同才加载，编辑器保存到一半的空文件、截断的文件不会替换当前规则集。
+// 当前规则集上用SetAction注册的回调会复制到新规则集
+type Watcher struct {
+	dir     string
+	current atomic.Value // *RuleSet
+	mu      sync.Mutex
+	sum     [sha256.Size]byte
+	pending [sha256.Size]byte
+	scanErr string // 上一次读取目录失败的错误，相同的错误只报告一次
+	events  chan ReloadEvent
+
+	// Interval 轮询间隔，0表示使用默认的2秒
+	Interval time.Duration
+	// OnReload 每次文件变化后调用，在Run的goroutine中执行
+	OnReload func(ReloadEvent)
+}
+
+// NewWatcher 加载目录中的规则文件，第一次加载失败时返回错误
+func NewWatcher(dir string) (*Watcher, error) {
+	w := &Watcher{dir: dir, events: make(chan ReloadEvent, 16)}
+	files, sum, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	s, err := LoadRuleFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+	w.sum, w.pending = sum, sum
+	w.current.Store(s)
+	return w, nil
+}
+
+// Rules 当前的规则集，可以在任意goroutine中调用
+func (w *Watcher) Rules() *RuleSet {
+	return w.current.Load().(*RuleSet)
+}
+
+// Events 重新加载事件的通道，通道已满时丢弃新的事件
+func (w *Watcher) Events() <-chan ReloadEvent {
+	return w.events
+}
+
+// Run 按Interval轮询直到ctx结束，返回ctx.Err()
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			w.Check()
+		}
+	}
+}
+
+// Check 立即检查一次，文件有变化并且与上一次检查时的内容相同时重新加载并返回true，
+// 第一次发现变化时只记录摘要，等下一次检查确认文件已经写完。
+// 同样的内容只加载一次，加载失败后要等文件再次变化才会重试；
+// 读取目录、文件失败时同样的错误只报告一次
+func (w *Watcher) Check() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	files, sum, err := w.scan()
+	if err != nil {
+		if err.Error() == w.scanErr {
+			return false, nil
+		}
+		w.scanErr = err.Error()
+	} else {
+		w.scanErr = ""
+	}
+	if err == nil && sum == w.sum {
+		w.pending = sum
+		return false, nil
+	}
+	if err == nil && sum != w.pending {
+		w.pending = sum
+		return false, nil
+	}
+	ev := ReloadEvent{Time: time.Now(), Files: files, Err: err}
+	if err == nil {
+		w.sum = sum
+		ev.Rules, ev.Err = LoadRuleFiles(files...)
+	}
+	if ev.Err == nil {
+		ev.Rules.copyActions(w.Rules())
+		w.current.Store(ev.Rules)
+	}
+	if w.OnReload != nil {
+		w.OnReload(ev)
+	}
+	select {
+	case w.events <- ev:
+	default:
+	}
+	return true, ev.Err
+}
+
+// scan 列出规则文件并计算文件名和内容的摘要
+func (w *Watcher) scan() ([]string, [sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	files, err := ruleFiles(w.dir)
+	if err != nil {
+		return nil, sum, err
+	}
+	h := sha256.New()
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, sum, err
+		}
+		io.WriteString(h, name)
+		h.Write([]byte{0})
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, sum, err
+		}
+		h.Write([]byte{0})
+	}
+	copy(sum[:], h.Sum(nil))
+	return files, sum, nil
+}
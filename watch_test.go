@@ -0,0 +1,143 @@
+package gorules
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher_Check(t *testing.T) {
+	dir := t.TempDir()
+	writeRuleFile(t, dir, "a.yaml", "- {id: a, when: x > 1, action: log}\n")
+	writeRuleFile(t, dir, "notes.txt", "ignored")
+	w, err := NewWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := w.Rules()
+	first.SetAction("log", func(interface{}, *Result) error { return nil })
+	if changed, err := w.Check(); changed || err != nil {
+		t.Fatalf("Check() = %v, %v, want no change", changed, err)
+	}
+
+	writeRuleFile(t, dir, "b.yaml", "- {id: b, when: x >}\n")
+	if changed, err := w.Check(); changed || err != nil {
+		t.Fatalf("Check() = %v, %v, want to wait for a second check", changed, err)
+	}
+	changed, err := w.Check()
+	var errs LoadErrors
+	if !changed || !errors.As(err, &errs) || w.Rules() != first {
+		t.Fatalf("Check() = %v, %v, want load error and the last good rules", changed, err)
+	}
+	if changed, _ := w.Check(); changed {
+		t.Error("Check() reloaded unchanged files after an error")
+	}
+
+	var events []ReloadEvent
+	w.OnReload = func(ev ReloadEvent) { events = append(events, ev) }
+	writeRuleFile(t, dir, "b.yaml", "- {id: b, when: x > 2}\n")
+	w.Check()
+	if changed, err := w.Check(); !changed || err != nil {
+		t.Fatalf("Check() = %v, %v", changed, err)
+	}
+	s := w.Rules()
+	if s == first || s.Len() != 2 || len(events) != 1 || events[0].Rules != s || len(events[0].Files) != 2 {
+		t.Fatalf("rules = %v, events = %+v", s.Rules(), events)
+	}
+	if _, err := s.Results(map[string]interface{}{"x": 3}, MatchAll); err != nil {
+		t.Errorf("actions were not kept after reload: %v", err)
+	}
+}
+
+func TestWatcher_Run(t *testing.T) {
+	dir := t.TempDir()
+	writeRuleFile(t, dir, "a.json", `[{"id": "a", "when": "x > 1"}]`)
+	if _, err := NewWatcher(t.TempDir() + "/missing"); err == nil {
+		t.Error("NewWatcher() on a missing directory should fail")
+	}
+	w, err := NewWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Interval = 5 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	writeRuleFile(t, dir, "a.json", `[{"id": "a", "when": "x > 1"}, {"id": "b", "when": "x > 2"}]`)
+	select {
+	case ev := <-w.Events():
+		if ev.Err != nil || ev.Rules.Len() != 2 || w.Rules() != ev.Rules {
+			t.Errorf("event = %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no reload event")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v", err)
+	}
+}
+
+func TestWatcher_scanError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rules")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeRuleFile(t, dir, "a.yaml", "- {id: a, when: x > 1}\n")
+	w, err := NewWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := w.Rules()
+	var events int
+	w.OnReload = func(ReloadEvent) { events++ }
+	if err := os.Rename(dir, dir+".bak"); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := w.Check(); !changed || err == nil {
+		t.Fatalf("Check() = %v, %v, want the scan error", changed, err)
+	}
+	for i := 0; i < 3; i++ {
+		if changed, err := w.Check(); changed || err != nil {
+			t.Fatalf("Check() = %v, %v, want the same error reported once", changed, err)
+		}
+	}
+	if err := os.Rename(dir+".bak", dir); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := w.Check(); changed || err != nil || w.Rules() != first || events != 1 {
+		t.Errorf("Check() = %v, %v, events = %d, want the last good rules", changed, err, events)
+	}
+}
+
+func TestWatcher_partialWrite(t *testing.T) {
+	dir := t.TempDir()
+	full := "- {id: a, when: x > 1}\n- {id: b, when: x > 2}\n"
+	writeRuleFile(t, dir, "a.yaml", full)
+	w, err := NewWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := w.Rules()
+	// 编辑器保存时先清空再写入，每次检查都看到不同的内容
+	for _, content := range []string{"", "- {id: a, when: x > 1}\n", full + "- {id: c, when: x > 3}\n"} {
+		writeRuleFile(t, dir, "a.yaml", content)
+		if changed, err := w.Check(); changed || err != nil || w.Rules() != first {
+			t.Fatalf("Check() with %q = %v, %v, want no reload", content, changed, err)
+		}
+	}
+	if changed, err := w.Check(); !changed || err != nil || w.Rules().Len() != 3 {
+		t.Fatalf("Check() = %v, %v, rules = %d, want 3 rules", changed, err, w.Rules().Len())
+	}
+
+	// 内容稳定的空文件仍然会加载
+	writeRuleFile(t, dir, "a.yaml", "")
+	w.Check()
+	if changed, err := w.Check(); !changed || err != nil || w.Rules().Len() != 0 {
+		t.Errorf("Check() = %v, %v, rules = %d, want empty rules", changed, err, w.Rules().Len())
+	}
+}